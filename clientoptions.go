@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+	"github.com/cloudflare/cloudflare-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	CLOUDFLARE_API_BASE_URL        = "CLOUDFLARE_API_BASE_URL"
+	CLOUDFLARE_API_RATE_LIMIT      = "CLOUDFLARE_API_RATE_LIMIT"
+	CLOUDFLARE_API_MAX_RETRIES     = "CLOUDFLARE_API_MAX_RETRIES"
+	CLOUDFLARE_API_MIN_RETRY_DELAY = "CLOUDFLARE_API_MIN_RETRY_DELAY"
+	CLOUDFLARE_API_MAX_RETRY_DELAY = "CLOUDFLARE_API_MAX_RETRY_DELAY"
+	CLOUDFLARE_API_RESOLVE         = "CLOUDFLARE_API_RESOLVE"
+	MAX_CLOCK_SKEW                 = "MAX_CLOCK_SKEW"
+	API_RATE_LIMIT                 = "API_RATE_LIMIT"
+)
+
+// configureClientOptions maps the supported env vars onto cloudflare-go client
+// options:
+//
+//	CLOUDFLARE_API_BASE_URL         cloudflare.BaseURL, e.g. for an api proxy
+//	CLOUDFLARE_API_MAX_RETRIES      cloudflare.UsingRetryPolicy, retries per request (default 3)
+//	CLOUDFLARE_API_MIN_RETRY_DELAY  cloudflare.UsingRetryPolicy, seconds (default 1)
+//	CLOUDFLARE_API_MAX_RETRY_DELAY  cloudflare.UsingRetryPolicy, seconds (default 30)
+//	CLOUDFLARE_API_RESOLVE          cloudflare.HTTPClient, host:ip pairs dialing host at ip instead of resolving it
+//
+// With DEBUG the requests of the client are logged, see loggingTransport. With
+// MAX_CLOCK_SKEW the local clock is checked against the responses, see
+// clockTransport. API_RATE_LIMIT limits the requests per second of every
+// client of the process together, e.g. including the one of a reloaded token,
+// see rateLimitTransport. Without it cloudflare-go limits each client to 4
+// requests per second. CLOUDFLARE_API_RATE_LIMIT is an alias of
+// API_RATE_LIMIT kept for existing configs, only one of them may be set.
+func (c *CloudflareDDNSUpdaterApplication) configureClientOptions() {
+	if base_url, exists := c.lookupEnv(CLOUDFLARE_API_BASE_URL); exists {
+		c.logger.Infof("using cloudflare api base url '%s'\n", base_url)
+		c.config.APIOptions = append(c.config.APIOptions, cloudflare.BaseURL(base_url))
+	}
+
+	var client *http.Client
+	if resolve_string, exists := c.lookupEnv(CLOUDFLARE_API_RESOLVE); exists {
+		resolve := map[string]string{}
+		for _, entry := range updater.SplitList(resolve_string) {
+			host, ip, valid := strings.Cut(strings.TrimSpace(entry), ":")
+			ip = strings.Trim(ip, "[]")
+			if !valid || host == "" || net.ParseIP(ip) == nil {
+				c.logger.Errorf("cloudflare api resolve entry '%s' is not of the form host:ip\n", entry)
+				c.exit()
+			}
+			c.logger.Infof("dialing '%s' at %s instead of resolving it\n", host, ip)
+			resolve[strings.ToLower(host)] = ip
+		}
+		client = newResolvingClient(resolve)
+	}
+	if c.debug {
+		if client == nil {
+			// a copy of the client cloudflare-go would use
+			client = &http.Client{}
+		}
+		client.Transport = &loggingTransport{next: client.Transport, logger: c.logger}
+	}
+	rate_limit_name := API_RATE_LIMIT
+	rate_limit_string, exists := c.lookupEnv(API_RATE_LIMIT)
+	if alias_string, alias_exists := c.lookupEnv(CLOUDFLARE_API_RATE_LIMIT); alias_exists {
+		if exists {
+			c.logger.Errorf("env vars '%s' and '%s' both set the api rate limit, only set '%s'\n", API_RATE_LIMIT, CLOUDFLARE_API_RATE_LIMIT, API_RATE_LIMIT)
+			c.exit()
+		}
+		rate_limit_name, rate_limit_string, exists = CLOUDFLARE_API_RATE_LIMIT, alias_string, true
+	}
+	if exists {
+		rate_limit, err := strconv.ParseFloat(rate_limit_string, 64)
+		if err != nil || rate_limit <= 0 {
+			c.logger.Errorf("value '%s' of env var '%s' is not a positive number of requests per second\n", rate_limit_string, rate_limit_name)
+			c.exit()
+		}
+		if client == nil {
+			client = &http.Client{}
+		}
+		c.logger.Infof("limiting all cloudflare api requests to %g per second\n", rate_limit)
+		client.Transport = &rateLimitTransport{next: client.Transport, limiter: rate.NewLimiter(rate.Limit(rate_limit), 1), logger: c.logger}
+		// lift the limit of each client to the shared one, which applies
+		c.config.APIOptions = append(c.config.APIOptions, cloudflare.UsingRateLimit(rate_limit))
+	}
+	if max_skew, exists := c.lookupDuration(MAX_CLOCK_SKEW); exists {
+		if client == nil {
+			client = &http.Client{}
+		}
+		c.logger.Infof("warning if the local clock is more than %s off from cloudflare's\n", max_skew.String())
+		client.Transport = &clockTransport{next: client.Transport, max_skew: max_skew, logger: c.logger}
+	}
+	if client != nil {
+		c.config.APIOptions = append(c.config.APIOptions, cloudflare.HTTPClient(client))
+	}
+
+	retry_policy := map[string]int{CLOUDFLARE_API_MAX_RETRIES: 3, CLOUDFLARE_API_MIN_RETRY_DELAY: 1, CLOUDFLARE_API_MAX_RETRY_DELAY: 30}
+	custom_retry_policy := false
+	for name := range retry_policy {
+		if value_string, exists := c.lookupEnv(name); exists {
+			value, err := strconv.Atoi(value_string)
+			if err != nil || value < 0 {
+				c.logger.Errorf("value '%s' of env var '%s' is not a non-negative integer\n", value_string, name)
+				c.exit()
+			}
+			retry_policy[name] = value
+			custom_retry_policy = true
+		}
+	}
+	if custom_retry_policy {
+		c.logger.Infof("retrying cloudflare api requests %d times with %ds to %ds delay\n", retry_policy[CLOUDFLARE_API_MAX_RETRIES], retry_policy[CLOUDFLARE_API_MIN_RETRY_DELAY], retry_policy[CLOUDFLARE_API_MAX_RETRY_DELAY])
+		c.config.APIOptions = append(c.config.APIOptions, cloudflare.UsingRetryPolicy(retry_policy[CLOUDFLARE_API_MAX_RETRIES], retry_policy[CLOUDFLARE_API_MIN_RETRY_DELAY], retry_policy[CLOUDFLARE_API_MAX_RETRY_DELAY]))
+	}
+}
+
+// loggingTransport logs the method, path and response status of every request
+// at debug level. Headers are not logged, they carry the api token.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger cloudflare.LeveledLoggerInterface
+}
+
+func (t *loggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	response, err := next.RoundTrip(request)
+	took := time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		t.logger.Debugf("cloudflare api %s %s failed after %s: %s\n", request.Method, request.URL.RequestURI(), took, err.Error())
+		return response, err
+	}
+	status := response.Status
+	if retry_after := response.Header.Get("Retry-After"); retry_after != "" {
+		status += ", retry after " + retry_after
+	}
+	t.logger.Debugf("cloudflare api %s %s: %s in %s\n", request.Method, request.URL.RequestURI(), status, took)
+	return response, err
+}
+
+// clockTransport compares the local clock with the Date header of every
+// response and warns once the skew exceeds max_skew, comment timestamps and
+// conflict warnings are misleading on a host with a wrong clock.
+type clockTransport struct {
+	next     http.RoundTripper
+	max_skew time.Duration
+	logger   cloudflare.LeveledLoggerInterface
+	skewed   atomic.Bool
+}
+
+func (t *clockTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	response, err := next.RoundTrip(request)
+	if err != nil {
+		return response, err
+	}
+	date, date_err := http.ParseTime(response.Header.Get("Date"))
+	if date_err != nil {
+		return response, err
+	}
+
+	// the date was taken somewhere during the request and is truncated to
+	// the second
+	elapsed := time.Since(start)
+	skew := start.Add(elapsed / 2).Sub(date)
+	if skew > 0 {
+		skew = max(skew-time.Second, 0)
+	}
+	if skew < 0 {
+		skew = -skew
+	}
+	skewed := skew > t.max_skew+elapsed/2
+	if skewed && !t.skewed.Swap(true) {
+		t.logger.Warnf("!!! the local clock is %s off from cloudflare's, comment timestamps and conflict warnings are misleading !!!\n", skew.Round(time.Second).String())
+	} else if !skewed && t.skewed.Swap(false) {
+		t.logger.Infof("the local clock is within %s of cloudflare's again\n", t.max_skew.String())
+	}
+	return response, err
+}
+
+// rateLimitTransport waits for its limiter before every request, the waits
+// are logged at debug level.
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *rate.Limiter
+	logger  cloudflare.LeveledLoggerInterface
+}
+
+func (t *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	reservation := t.limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		t.logger.Debugf("waiting %s for the api rate limit before %s %s\n", delay.Round(time.Millisecond).String(), request.Method, request.URL.Path)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-request.Context().Done():
+			reservation.Cancel()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+	}
+	return next.RoundTrip(request)
+}
+
+// newResolvingClient returns an http client dialing the given hosts at fixed
+// ips, e.g. for split-horizon dns. tls still verifies the hostname.
+func newResolvingClient(resolve map[string]string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if ip, exists := resolve[strings.ToLower(host)]; exists {
+			address = net.JoinHostPort(ip, port)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	CONFIG_FILE = "CONFIG_FILE"
+	PROFILE     = "PROFILE"
+)
+
+// loadConfigFile reads the settings of the file named by the --config flag or
+// else by CONFIG_FILE, "-" reads them from stdin. The file has one NAME=value
+// per line, e.g.
+//
+//	CLOUDFLARE_ZONE_NAME=example.com
+//
+//	[home]
+//	CLOUDFLARE_RECORD_NAME=home.example.com
+//	RECORD_MIRRORS=example.net:home.example.net
+//
+//	[vps]
+//	CLOUDFLARE_RECORD_NAME=vps.example.com
+//
+// or is the same as a json object, profiles being nested objects:
+//
+//	{"CLOUDFLARE_ZONE_NAME": "example.com", "home": {"CLOUDFLARE_RECORD_NAME": "home.example.com"}}
+//
+// or as yaml, where a list is a comma separated list:
+//
+//	CLOUDFLARE_ZONE_NAME: example.com
+//	home:
+//	  CLOUDFLARE_RECORD_NAME: home.example.com
+//	  RECORD_ALIASES: [a.example.com, b.example.com]
+//
+// Settings before the first [profile] apply to every profile, the settings of
+// the selected profile (PROFILE env var or --profile flag) are added to them.
+// Env vars take precedence over the config file.
+func (c *CloudflareDDNSUpdaterApplication) loadConfigFile(path string, profile string) {
+	c.config_file = map[string]string{}
+
+	if path == "" {
+		path = os.Getenv(CONFIG_FILE)
+	}
+	if path == "" {
+		if profile != "" {
+			c.logger.Errorf("profile '%s' was selected, but no config file was given in env var '%s' or with --config\n", profile, CONFIG_FILE)
+			c.exit()
+		}
+		return
+	}
+
+	var data []byte
+	var err error
+	if path == "-" {
+		path = "stdin"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		c.logger.Errorf("config file '%s' could not be read: %s\n", path, err.Error())
+		c.exit()
+	}
+
+	var profiles []string
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")):
+		profiles, err = c.parseJSONConfig(data, profile)
+	case isYAMLConfig(path, data):
+		profiles, err = c.parseYAMLConfig(data, profile)
+	default:
+		profiles, err = c.parseConfig(data, profile)
+	}
+	if err != nil {
+		c.logger.Errorf("config file '%s' is invalid: %s\n", path, err.Error())
+		c.exit()
+	}
+
+	if profile == "" {
+		c.logger.Infof("using config file '%s'\n", path)
+		return
+	}
+	for _, known := range profiles {
+		if known == profile {
+			c.logger.Infof("using profile '%s' of config file '%s'\n", profile, path)
+			return
+		}
+	}
+	c.logger.Errorf("profile '%s' does not exist in config file '%s', it defines %v\n", profile, path, profiles)
+	c.exit()
+}
+
+// parseConfig reads NAME=value lines and [profile] sections into config_file
+// and returns the profiles defined.
+func (c *CloudflareDDNSUpdaterApplication) parseConfig(data []byte, profile string) ([]string, error) {
+	profiles := []string{}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line_number := 1; scanner.Scan(); line_number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			profiles = append(profiles, section)
+			continue
+		}
+		name, value, valid := strings.Cut(line, "=")
+		if !valid {
+			return nil, fmt.Errorf("line %d is not of the form NAME=value", line_number)
+		}
+		if section == "" || section == profile {
+			c.config_file[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return profiles, scanner.Err()
+}
+
+// parseJSONConfig reads a json object into config_file, nested objects are
+// profiles, and returns the profiles defined. Numbers and booleans are taken
+// as they are written.
+func (c *CloudflareDDNSUpdaterApplication) parseJSONConfig(data []byte, profile string) ([]string, error) {
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+
+	profiles := []string{}
+	for name, raw := range settings {
+		if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			value, err := jsonSetting(raw)
+			if err != nil {
+				return nil, fmt.Errorf("setting '%s': %w", name, err)
+			}
+			// like in a file, profile settings are added to the shared ones
+			if _, exists := c.config_file[name]; !exists {
+				c.config_file[name] = value
+			}
+			continue
+		}
+
+		profiles = append(profiles, name)
+		var profile_settings map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &profile_settings); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+		for profile_name, profile_raw := range profile_settings {
+			value, err := jsonSetting(profile_raw)
+			if err != nil {
+				return nil, fmt.Errorf("setting '%s' of profile '%s': %w", profile_name, name, err)
+			}
+			if name == profile {
+				c.config_file[profile_name] = value
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// jsonSetting returns a json string, number or boolean as an env var value.
+func jsonSetting(raw json.RawMessage) (string, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String(), nil
+	}
+	var boolean bool
+	if err := json.Unmarshal(raw, &boolean); err == nil {
+		return fmt.Sprint(boolean), nil
+	}
+	return "", fmt.Errorf("'%s' is not a string, number or boolean", string(raw))
+}
+
+// isYAMLConfig tells yaml from NAME=value lines by the extension of the file
+// or, e.g. on stdin, by the first setting being of the form NAME: value.
+func isYAMLConfig(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "---" {
+			return true
+		}
+		colon, equals := strings.Index(line, ":"), strings.Index(line, "=")
+		return colon > 0 && (equals < 0 || colon < equals)
+	}
+	return false
+}
+
+// parseYAMLConfig reads a yaml mapping into config_file like parseJSONConfig,
+// nested mappings are profiles. A list of values is joined into a comma
+// separated list, escaping the commas in its values.
+func (c *CloudflareDDNSUpdaterApplication) parseYAMLConfig(data []byte, profile string) ([]string, error) {
+	var settings map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+
+	profiles := []string{}
+	for name, node := range settings {
+		if node.Kind != yaml.MappingNode {
+			value, err := yamlSetting(&node)
+			if err != nil {
+				return nil, fmt.Errorf("setting '%s': %w", name, err)
+			}
+			// like in a file, profile settings are added to the shared ones
+			if _, exists := c.config_file[name]; !exists {
+				c.config_file[name] = value
+			}
+			continue
+		}
+
+		profiles = append(profiles, name)
+		var profile_settings map[string]yaml.Node
+		if err := node.Decode(&profile_settings); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", name, err)
+		}
+		for profile_name, profile_node := range profile_settings {
+			value, err := yamlSetting(&profile_node)
+			if err != nil {
+				return nil, fmt.Errorf("setting '%s' of profile '%s': %w", profile_name, name, err)
+			}
+			if name == profile {
+				c.config_file[profile_name] = value
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// yamlSetting returns a yaml scalar, or a list of them, as an env var value.
+func yamlSetting(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := []string{}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("line %d is not a list of values", item.Line)
+			}
+			// every backslash is escaped, so one ending a value can not
+			// escape the joining comma, see updater.SplitList
+			escaped := strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(item.Value)
+			values = append(values, escaped)
+		}
+		return strings.Join(values, ","), nil
+	default:
+		return "", fmt.Errorf("line %d is not a value or a list of values", node.Line)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+func TestParseYAMLConfigLists(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		entries []string
+	}{
+		{"plain", "RECORD_ALIASES: [a, b]", []string{"a", "b"}},
+		{"comma", `RECORD_ALIASES: ["v=spf1 a, mx", b]`, []string{"v=spf1 a, mx", "b"}},
+		{"trailing backslash", `RECORD_ALIASES: ['a\', b]`, []string{`a\`, "b"}},
+		{"escaped comma", `RECORD_ALIASES: ['a\,b', c]`, []string{`a\,b`, "c"}},
+		{"double backslash", `RECORD_ALIASES: ['a\\', b]`, []string{`a\\`, "b"}},
+		{"inner backslash", `RECORD_ALIASES: ['a\b']`, []string{`a\b`}},
+		{"block list", "RECORD_ALIASES:\n  - a,b\n  - c", []string{"a,b", "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &CloudflareDDNSUpdaterApplication{config_file: map[string]string{}}
+			if _, err := c.parseYAMLConfig([]byte(test.yaml), ""); err != nil {
+				t.Fatalf("parseYAMLConfig() failed: %s", err.Error())
+			}
+			entries := updater.SplitList(c.config_file[RECORD_ALIASES])
+			if strings.Join(entries, "|") != strings.Join(test.entries, "|") || len(entries) != len(test.entries) {
+				t.Errorf("the list '%s' is split into %q, want %q", c.config_file[RECORD_ALIASES], entries, test.entries)
+			}
+		})
+	}
+}
+
+func TestParseYAMLConfigProfiles(t *testing.T) {
+	c := &CloudflareDDNSUpdaterApplication{config_file: map[string]string{}}
+	profiles, err := c.parseYAMLConfig([]byte("CLOUDFLARE_ZONE_NAME: example.com\nDURATION_BETWEEN_UPDATES: 5m\nhome:\n  CLOUDFLARE_RECORD_NAME: home\n  DURATION_BETWEEN_UPDATES: 1m\noffice:\n  CLOUDFLARE_RECORD_NAME: office\n"), "home")
+	if err != nil {
+		t.Fatalf("parseYAMLConfig() failed: %s", err.Error())
+	}
+	if strings.Join(profiles, ",") != "home,office" {
+		t.Errorf("profiles are %v, want [home office]", profiles)
+	}
+	want := map[string]string{ZONE_ENV_VARIABLE_NAME: "example.com", RECORD_ENV_VARIABLE_NAME: "home", DURATION_BETWEEN_UPDATES: "1m"}
+	for name, value := range want {
+		if c.config_file[name] != value {
+			t.Errorf("'%s' is '%s', want '%s'", name, c.config_file[name], value)
+		}
+	}
+	if _, err := c.parseYAMLConfig([]byte("RECORD_ALIASES: [[a]]"), ""); err == nil {
+		t.Errorf("parseYAMLConfig() of a nested list succeeded")
+	}
+}
+
+func TestParseJSONConfig(t *testing.T) {
+	c := &CloudflareDDNSUpdaterApplication{config_file: map[string]string{}}
+	profiles, err := c.parseJSONConfig([]byte(`{"CLOUDFLARE_ZONE_NAME": "example.com", "IP_MAX_RETRIES": 3, "SKIP_CGNAT": true, "RECORD_ALIASES": "a\\,b,c", "home": {"CLOUDFLARE_RECORD_NAME": "home", "IP_MAX_RETRIES": 5}}`), "home")
+	if err != nil {
+		t.Fatalf("parseJSONConfig() failed: %s", err.Error())
+	}
+	if strings.Join(profiles, ",") != "home" {
+		t.Errorf("profiles are %v, want [home]", profiles)
+	}
+	want := map[string]string{ZONE_ENV_VARIABLE_NAME: "example.com", RECORD_ENV_VARIABLE_NAME: "home", IP_MAX_RETRIES: "5", SKIP_CGNAT: "true"}
+	for name, value := range want {
+		if c.config_file[name] != value {
+			t.Errorf("'%s' is '%s', want '%s'", name, c.config_file[name], value)
+		}
+	}
+	if entries := updater.SplitList(c.config_file[RECORD_ALIASES]); strings.Join(entries, "|") != "a,b|c" {
+		t.Errorf("the list '%s' is split into %q, want [\"a,b\" \"c\"]", c.config_file[RECORD_ALIASES], entries)
+	}
+	if _, err := c.parseJSONConfig([]byte(`{"RECORD_ALIASES": ["a"]}`), ""); err == nil {
+		t.Errorf("parseJSONConfig() of a list succeeded")
+	}
+}
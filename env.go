@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupEnv looks up a setting from the env var of the given name or, if that
+// is not set, from the file named by the env var <name>_FILE. This allows any
+// setting to be injected from a mounted secret or config map. Settings that are
+// set neither way are taken from the config file, see loadConfigFile, where
+// <name>_FILE names a file as well.
+func (c *CloudflareDDNSUpdaterApplication) lookupEnv(name string) (string, bool) {
+	if value, exists := os.LookupEnv(name); exists {
+		return value, true
+	}
+
+	path, exists := c.secretFile(name)
+	if !exists {
+		value, exists := c.config_file[name]
+		return value, exists
+	}
+
+	value, err := readSecretFile(path)
+	if err != nil {
+		c.logger.Errorf("file '%s' given in '%s' could not be read: %s\n", path, name+"_FILE", err.Error())
+		c.exit()
+	}
+	return value, true
+}
+
+// secretFile returns the file a setting is read from, if it is read from one,
+// like lookupEnv does. A setting that is given directly is not.
+func (c *CloudflareDDNSUpdaterApplication) secretFile(name string) (string, bool) {
+	if _, exists := os.LookupEnv(name); exists {
+		return "", false
+	}
+	if path, exists := os.LookupEnv(name + "_FILE"); exists {
+		return path, true
+	}
+	if _, exists := c.config_file[name]; exists {
+		return "", false
+	}
+	path, exists := c.config_file[name+"_FILE"]
+	return path, exists
+}
+
+func readSecretFile(path string) (string, error) {
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+func (c *CloudflareDDNSUpdaterApplication) lookupBool(name string) bool {
+	value, exists := c.lookupEnv(name)
+	if !exists {
+		return false
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		c.logger.Errorf("value '%s' of env var '%s' is not a boolean\n", value, name)
+		c.exit()
+	}
+	return parsed
+}
+
+// cutEnabled cuts the enabled option off an entry of a list, e.g.
+// "home.example.com enabled=false" keeps the entry configured but skips it.
+// Entries are enabled by default.
+func (c *CloudflareDDNSUpdaterApplication) cutEnabled(entry string) (string, bool) {
+	fields := strings.Fields(entry)
+	if len(fields) < 1 {
+		return "", true
+	}
+	enabled := true
+	for _, option := range fields[1:] {
+		value, found := strings.CutPrefix(option, "enabled=")
+		parsed, err := strconv.ParseBool(value)
+		if !found || err != nil {
+			c.logger.Errorf("option '%s' of entry '%s' is not supported, use 'enabled=<true|false>'\n", option, fields[0])
+			c.exit()
+		}
+		enabled = parsed
+	}
+	return fields[0], enabled
+}
+
+// lookupRetries reads a retry count and the delay between retries, a missing
+// delay is left at zero for the updater's default.
+func (c *CloudflareDDNSUpdaterApplication) lookupRetries(retries_name string, delay_name string) (int, time.Duration) {
+	retries, delay := 0, time.Duration(0)
+	if retries_string, exists := c.lookupEnv(retries_name); exists {
+		parsed, err := strconv.Atoi(retries_string)
+		if err != nil || parsed < 0 {
+			c.logger.Errorf("value '%s' of env var '%s' is not a non-negative integer\n", retries_string, retries_name)
+			c.exit()
+		}
+		retries = parsed
+	}
+	if parsed, exists := c.lookupDuration(delay_name); exists {
+		delay = parsed
+	}
+	return retries, delay
+}
+
+// lookupDuration reads a positive duration. A bare number is rejected with a
+// hint to add a unit, as time.ParseDuration only accepts that for zero.
+func (c *CloudflareDDNSUpdaterApplication) lookupDuration(name string) (time.Duration, bool) {
+	value, exists := c.lookupEnv(name)
+	if !exists {
+		return 0, false
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		if _, number_err := strconv.ParseFloat(value, 64); number_err == nil {
+			c.logger.Errorf("value '%s' of env var '%s' has no unit, did you mean '%ss'?\n", value, name, value)
+		} else {
+			c.logger.Errorf("value '%s' of env var '%s' is not a duration like '30s' or '5m': %s\n", value, name, err.Error())
+		}
+		c.exit()
+	}
+	if parsed <= 0 {
+		c.logger.Errorf("value '%s' of env var '%s' must be a positive duration\n", value, name)
+		c.exit()
+	}
+	return parsed, true
+}
+
+// readCurrentIP reads the ip of IP_SOURCE=env on every update, like lookupEnv
+// but failing instead of exiting. The file named by CURRENT_IP_FILE can be
+// rewritten by another tool while we are running, unlike the env var.
+func (c *CloudflareDDNSUpdaterApplication) readCurrentIP() (string, error) {
+	if value, exists := os.LookupEnv(CURRENT_IP); exists {
+		return value, nil
+	}
+	if path, exists := os.LookupEnv(CURRENT_IP + "_FILE"); exists {
+		value, err := os.ReadFile(path)
+		return string(value), err
+	}
+	if value, exists := c.config_file[CURRENT_IP]; exists {
+		return value, nil
+	}
+	return "", fmt.Errorf("env var '%s' is not set", CURRENT_IP)
+}
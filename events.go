@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// EVENTS_NDJSON writes an Event per line to stdout, the logs go to stderr then
+const EVENTS_NDJSON = "EVENTS_NDJSON"
+
+// Event is one line of EVENTS_NDJSON. Every event has the time, the type and
+// the zone, the other fields depend on the type:
+//
+//	check   record_type, ip (empty if it could not be detected), duration_ms
+//	        and actions, the number of records by action, e.g. {"updated": 1}
+//	change  record, old_ip and new_ip of a record that was updated or created
+//	error   record_type and error of a failed check
+//	notify  record and publisher of a published change, error if it failed
+type Event struct {
+	Time       time.Time      `json:"time"`
+	Type       string         `json:"type"`
+	Zone       string         `json:"zone"`
+	RecordType string         `json:"record_type,omitempty"`
+	Record     string         `json:"record,omitempty"`
+	IP         string         `json:"ip,omitempty"`
+	OldIP      string         `json:"old_ip,omitempty"`
+	NewIP      string         `json:"new_ip,omitempty"`
+	DurationMS int64          `json:"duration_ms,omitempty"`
+	Actions    map[string]int `json:"actions,omitempty"`
+	Publisher  string         `json:"publisher,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// EventWriter writes events as ndjson, a nil EventWriter drops them.
+type EventWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewEventWriter(writer io.Writer) *EventWriter {
+	return &EventWriter{encoder: json.NewEncoder(writer)}
+}
+
+func (w *EventWriter) Emit(event Event) {
+	if w == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.encoder.Encode(event)
+}
+
+// configureEvents writes events to stdout if EVENTS_NDJSON is set, moving the
+// logs that would go there to stderr. If the output of a command like
+// --print-ip or --json owns stdout, the events go to stderr with the logs.
+func (c *CloudflareDDNSUpdaterApplication) configureEvents() {
+	if !c.lookupBool(EVENTS_NDJSON) {
+		return
+	}
+	if c.stdout_output {
+		c.events = NewEventWriter(os.Stderr)
+		c.logger.Infof("writing events as ndjson to stderr, stdout is kept for the output\n")
+		return
+	}
+	switch logger := c.logger.(type) {
+	case *cloudflare.LeveledLogger:
+		c.logger = &WriterLeveledLogger{Level: logger.Level, Writer: os.Stderr}
+	case *JSONLeveledLogger:
+		if logger.Output == os.Stdout {
+			logger.Output = os.Stderr
+		}
+	}
+	c.events = NewEventWriter(os.Stdout)
+	c.logger.Infof("writing events as ndjson to stdout\n")
+}
+
+// emitResult emits the check, change and error events of a result.
+func (c *CloudflareDDNSUpdaterApplication) emitResult(result updater.Result) {
+	for _, check := range result.Checks {
+		c.events.Emit(Event{
+			Time:       result.CheckedAt,
+			Type:       "check",
+			Zone:       c.config.ZoneName,
+			RecordType: check.RecordType,
+			IP:         check.IP,
+			DurationMS: check.Duration.Milliseconds(),
+			Actions:    check.Actions(),
+		})
+		for _, record := range check.Records {
+			if record.Action != "updated" && record.Action != "created" {
+				continue
+			}
+			c.events.Emit(Event{Time: result.CheckedAt, Type: "change", Zone: c.config.ZoneName, Record: record.Name, OldIP: record.PreviousContent, NewIP: record.Content})
+		}
+		if check.Err != nil {
+			c.events.Emit(Event{Time: result.CheckedAt, Type: "error", Zone: c.config.ZoneName, RecordType: check.RecordType, Error: check.Err.Error()})
+		}
+	}
+}
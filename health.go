@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	HEALTH_LISTEN_ADDRESS = "HEALTH_LISTEN_ADDRESS"
+	HEALTH_LISTEN_NETWORK = "HEALTH_LISTEN_NETWORK"
+	HEALTH_CHECK_INTERVAL = "HEALTH_CHECK_INTERVAL"
+)
+
+// checkRecords periodically checks that the managed records still exist, a
+// missing record makes /healthz report unhealthy until it exists again.
+func (c *CloudflareDDNSUpdaterApplication) checkRecords(ctx context.Context) {
+	ticker := time.NewTicker(c.health_check_interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		missing, err := c.updater.MissingRecords(ctx)
+		if err != nil {
+			// the api being unavailable says nothing about the records
+			c.logger.Warnf("health check could not check the records: %s\n", err.Error())
+			continue
+		}
+		if len(missing) > 0 {
+			c.logger.Errorf("health check found managed records missing: [%s]\n", strings.Join(missing, ", "))
+		}
+		c.missing_records.Store(missing)
+	}
+}
+
+// serveHealthz is the liveness, the process is up and serving and, with a
+// health check interval, the managed records still exist. Asked for json, with
+// an Accept header or ?format=json, it includes the history of the changes.
+func (c *CloudflareDDNSUpdaterApplication) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	missing, _ := c.missing_records.Load().([]string)
+	status := http.StatusOK
+	if len(missing) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		response := struct {
+			Status         string          `json:"status"`
+			MissingRecords []string        `json:"missing_records,omitempty"`
+			History        HistoryResponse `json:"history"`
+		}{Status: "ok", MissingRecords: missing, History: c.history.Response()}
+		if len(missing) > 0 {
+			response.Status = "missing records"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	w.WriteHeader(status)
+	if len(missing) > 0 {
+		w.Write([]byte("missing records: " + strings.Join(missing, ", ") + "\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (c *CloudflareDDNSUpdaterApplication) serveHealth(ctx context.Context) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", c.serveHealthz)
+
+	// readiness, the record has been confirmed up-to-date at least once
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if !c.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ready\n"))
+	})
+
+	// the last changes, to tell how often the ip actually changes
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.history.Response())
+	})
+
+	// the recent log lines, only with a token to read them
+	if c.log_buffer != nil {
+		mux.HandleFunc("/logs", c.serveLogs)
+	}
+
+	if c.health_listen_network == "unix" {
+		// a socket left behind by a previous run would make listening fail
+		if err := os.Remove(c.health_listen_address); err != nil && !os.IsNotExist(err) {
+			c.logger.Errorf("stale health socket '%s' could not be removed: %s\n", c.health_listen_address, err.Error())
+			c.exit()
+		}
+	}
+
+	listener, err := net.Listen(c.health_listen_network, c.health_listen_address)
+	if err != nil {
+		c.logger.Errorf("health endpoints could not listen on %s '%s': %s\n", c.health_listen_network, c.health_listen_address, err.Error())
+		c.exit()
+	}
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown_ctx)
+	}()
+
+	c.logger.Infof("health endpoints listening on %s '%s'\n", c.health_listen_network, c.health_listen_address)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		c.logger.Errorf("health endpoints could not be served on '%s': %s\n", c.health_listen_address, err.Error())
+		c.exit()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+func TestServeHealthzHistory(t *testing.T) {
+	c := &CloudflareDDNSUpdaterApplication{history: NewHistory(5)}
+	c.history.Observe(updater.Result{
+		CheckedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Checks: []updater.Check{{Records: []updater.RecordResult{
+			{Name: "home.example.com", Action: "updated", Content: "203.0.113.9", PreviousContent: "198.51.100.7"},
+		}}},
+	})
+
+	for _, target := range []string{"/healthz?format=json", "/healthz"} {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		if target == "/healthz" {
+			request.Header.Set("Accept", "application/json")
+		}
+		recorder := httptest.NewRecorder()
+		c.serveHealthz(recorder, request)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s responded %d, want %d", target, recorder.Code, http.StatusOK)
+		}
+		var response struct {
+			Status  string          `json:"status"`
+			History HistoryResponse `json:"history"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s responded no json '%s': %s", target, recorder.Body.String(), err.Error())
+		}
+		if response.Status != "ok" || len(response.History.Changes) != 1 || response.History.Changes[0].NewIP != "203.0.113.9" || response.History.ChangedSince == nil {
+			t.Errorf("%s responded %+v, want ok with the change to 203.0.113.9", target, response)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	c.missing_records.Store([]string{"home.example.com"})
+	c.serveHealthz(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != "missing records: home.example.com\n" {
+		t.Errorf("/healthz responded %d '%s', want the missing record as text", recorder.Code, recorder.Body.String())
+	}
+}
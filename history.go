@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+const HISTORY_SIZE = "HISTORY_SIZE"
+
+// HistoryEntry is one change of a record's content.
+type HistoryEntry struct {
+	Time   time.Time `json:"time"`
+	Record string    `json:"record"`
+	OldIP  string    `json:"old_ip"`
+	NewIP  string    `json:"new_ip"`
+}
+
+// History keeps the last changes in memory, bounded to size entries.
+type History struct {
+	mutex   sync.Mutex
+	size    int
+	entries []HistoryEntry
+}
+
+func NewHistory(size int) *History {
+	return &History{size: size}
+}
+
+// Observe adds every updated record of a result to the history.
+func (h *History) Observe(result updater.Result) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, check := range result.Checks {
+		for _, record := range check.Records {
+			if record.Action != "updated" {
+				continue
+			}
+			h.entries = append(h.entries, HistoryEntry{Time: result.CheckedAt, Record: record.Name, OldIP: record.PreviousContent, NewIP: record.Content})
+		}
+	}
+	if len(h.entries) > h.size {
+		h.entries = append([]HistoryEntry{}, h.entries[len(h.entries)-h.size:]...)
+	}
+}
+
+// HistoryResponse is the history as served by /history and in the json of
+// /healthz.
+type HistoryResponse struct {
+	ChangedSince *time.Time     `json:"changed_since,omitempty"`
+	Changes      []HistoryEntry `json:"changes"`
+}
+
+// Response returns the history with the time of the last change.
+func (h *History) Response() HistoryResponse {
+	entries := h.Entries()
+	response := HistoryResponse{Changes: entries}
+	if len(entries) > 0 {
+		response.ChangedSince = &entries[len(entries)-1].Time
+	}
+	return response
+}
+
+// Entries returns a copy of the history, oldest change first.
+func (h *History) Entries() []HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]HistoryEntry{}, h.entries...)
+}
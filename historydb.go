@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"beemo.at/cloudflare-ddns/updater"
+	_ "modernc.org/sqlite"
+)
+
+// HISTORY_DB records every check and change in a sqlite file, e.g. how often
+// the ip changed:
+//
+//	SELECT date(time, 'unixepoch', 'start of month'), count(*) FROM changes GROUP BY 1
+const HISTORY_DB = "HISTORY_DB"
+
+// history_schema is created if missing, times are unix seconds.
+const history_schema = `
+CREATE TABLE IF NOT EXISTS checks (
+	time        INTEGER NOT NULL,
+	record_type TEXT NOT NULL,
+	ip          TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	actions     TEXT NOT NULL,
+	error       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS checks_time ON checks (time);
+CREATE TABLE IF NOT EXISTS changes (
+	time   INTEGER NOT NULL,
+	record TEXT NOT NULL,
+	action TEXT NOT NULL,
+	old_ip TEXT NOT NULL,
+	new_ip TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS changes_time ON changes (time);
+`
+
+// HistoryDB is the sqlite sink of the history, all methods are no-ops on a nil
+// *HistoryDB.
+type HistoryDB struct {
+	db *sql.DB
+}
+
+func OpenHistoryDB(path string) (*HistoryDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection serializes the writes of the families
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(history_schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &HistoryDB{db: db}, nil
+}
+
+// Close closes the database, after the last result has been observed.
+func (h *HistoryDB) Close() error {
+	if h == nil {
+		return nil
+	}
+	return h.db.Close()
+}
+
+// Observe records the checks of a result and the records they updated or
+// created in a single transaction.
+func (h *HistoryDB) Observe(result updater.Result) error {
+	if h == nil {
+		return nil
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, check := range result.Checks {
+		actions, err := json.Marshal(check.Actions())
+		if err != nil {
+			return err
+		}
+		check_err := ""
+		if check.Err != nil {
+			check_err = check.Err.Error()
+		}
+		if _, err := tx.Exec("INSERT INTO checks VALUES (?, ?, ?, ?, ?, ?)", result.CheckedAt.Unix(), check.RecordType, check.IP, check.Duration.Milliseconds(), string(actions), check_err); err != nil {
+			return err
+		}
+		for _, record := range check.Records {
+			if record.Action != "updated" && record.Action != "created" {
+				continue
+			}
+			if _, err := tx.Exec("INSERT INTO changes VALUES (?, ?, ?, ?, ?)", result.CheckedAt.Unix(), record.Name, record.Action, record.PreviousContent, record.Content); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
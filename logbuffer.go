@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"beemo.at/cloudflare-ddns/updater"
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	LOG_BUFFER_SIZE = "LOG_BUFFER_SIZE"
+	// HEALTH_LOGS_TOKEN enables /logs on the health server for requests
+	// bearing this token
+	HEALTH_LOGS_TOKEN = "HEALTH_LOGS_TOKEN"
+)
+
+// max_log_line_size caps the memory of a single buffered line
+const max_log_line_size = 1024
+
+// LogBuffer keeps the last log lines in memory, bounded to size lines. Secrets
+// are redacted before a line is kept.
+type LogBuffer struct {
+	mutex   sync.Mutex
+	size    int
+	lines   []string
+	secrets []string
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{size: size}
+}
+
+// Redact replaces secret in every line added from now on.
+func (b *LogBuffer) Redact(secret string) {
+	if b == nil || secret == "" {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.secrets = append(b.secrets, secret)
+}
+
+func (b *LogBuffer) Add(line string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, secret := range b.secrets {
+		line = strings.ReplaceAll(line, secret, "[redacted]")
+	}
+	if len(line) > max_log_line_size {
+		line = line[:max_log_line_size] + "...\n"
+	}
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.size {
+		b.lines = b.lines[len(b.lines)-b.size:]
+	}
+}
+
+func (b *LogBuffer) Lines() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.lines...)
+}
+
+// BufferedLeveledLogger logs to Logger and keeps everything but debug lines in
+// Buffer too.
+type BufferedLeveledLogger struct {
+	Logger cloudflare.LeveledLoggerInterface
+	Buffer *LogBuffer
+}
+
+func (l *BufferedLeveledLogger) Debugf(format string, v ...interface{}) {
+	l.Logger.Debugf(format, v...)
+}
+
+func (l *BufferedLeveledLogger) Infof(format string, v ...interface{}) {
+	l.Logger.Infof(format, v...)
+	l.Buffer.Add(fmt.Sprintf("[info] "+format, v...))
+}
+
+func (l *BufferedLeveledLogger) InfoWith(message string, fields map[string]any) {
+	logger, ok := l.Logger.(updater.FieldLogger)
+	if !ok {
+		l.Infof("%s\n", message)
+		return
+	}
+	logger.InfoWith(message, fields)
+	encoded, _ := json.Marshal(fields)
+	l.Buffer.Add(fmt.Sprintf("[info] %s: %s\n", message, encoded))
+}
+
+func (l *BufferedLeveledLogger) Warnf(format string, v ...interface{}) {
+	l.Logger.Warnf(format, v...)
+	l.Buffer.Add(fmt.Sprintf("[warn] "+format, v...))
+}
+
+func (l *BufferedLeveledLogger) Errorf(format string, v ...interface{}) {
+	l.Logger.Errorf(format, v...)
+	l.Buffer.Add(fmt.Sprintf("[error] "+format, v...))
+}
+
+// configureLogBuffer buffers the recent log lines for /logs, only if a token
+// to read them is configured.
+func (c *CloudflareDDNSUpdaterApplication) configureLogBuffer() {
+	logs_token, exists := c.lookupEnv(HEALTH_LOGS_TOKEN)
+	if !exists {
+		return
+	}
+	if logs_token == "" {
+		c.logger.Errorf("env var '%s' is empty, /logs would be readable by anyone\n", HEALTH_LOGS_TOKEN)
+		c.exit()
+	}
+
+	size := 200
+	if size_string, exists := c.lookupEnv(LOG_BUFFER_SIZE); exists {
+		parsed, err := strconv.Atoi(size_string)
+		if err != nil || parsed < 1 {
+			c.logger.Errorf("log buffer size '%s' is not a positive number of lines\n", size_string)
+			c.exit()
+		}
+		size = parsed
+	}
+
+	c.logs_token.Store(logs_token)
+	c.log_buffer = NewLogBuffer(size)
+	c.log_buffer.Redact(logs_token)
+	c.logger = &BufferedLeveledLogger{Logger: c.logger, Buffer: c.log_buffer}
+	c.logger.Infof("keeping the last %d log lines for /logs\n", size)
+}
+
+// serveLogs serves the buffered log lines to requests bearing the logs token.
+func (c *CloudflareDDNSUpdaterApplication) serveLogs(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	logs_token, _ := c.logs_token.Load().(string)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(logs_token)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("unauthorized\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	for _, line := range c.log_buffer.Lines() {
+		w.Write([]byte(line))
+	}
+}
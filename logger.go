@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	LOG_FILE        = "LOG_FILE"
+	LOG_MAX_SIZE    = "LOG_MAX_SIZE"
+	LOG_MAX_BACKUPS = "LOG_MAX_BACKUPS"
+	// DEBUG logs at debug level, including every cloudflare api request
+	DEBUG = "DEBUG"
+	// LOG_FORMAT is "text" (default) or "json", a json object per line
+	LOG_FORMAT = "LOG_FORMAT"
+)
+
+// WriterLeveledLogger is a leveled logger with the same output format as
+// cloudflare.LeveledLogger, but writing every level to a single writer.
+type WriterLeveledLogger struct {
+	Level  cloudflare.Level
+	Writer io.Writer
+}
+
+func (l *WriterLeveledLogger) Debugf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelDebug {
+		fmt.Fprintf(l.Writer, "[debug] "+format, v...)
+	}
+}
+
+func (l *WriterLeveledLogger) Infof(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelInfo {
+		fmt.Fprintf(l.Writer, "[info] "+format, v...)
+	}
+}
+
+func (l *WriterLeveledLogger) Warnf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelWarn {
+		fmt.Fprintf(l.Writer, "[warn] "+format, v...)
+	}
+}
+
+func (l *WriterLeveledLogger) Errorf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelError {
+		fmt.Fprintf(l.Writer, "[error] "+format, v...)
+	}
+}
+
+// JSONLeveledLogger logs a json object with time, level and message per line,
+// debug and info lines to Output, warnings and errors to ErrorOutput.
+type JSONLeveledLogger struct {
+	Level       cloudflare.Level
+	Output      io.Writer
+	ErrorOutput io.Writer
+	mutex       sync.Mutex
+}
+
+func (l *JSONLeveledLogger) write(writer io.Writer, level string, message string, fields map[string]any) {
+	line := map[string]any{"time": time.Now(), "level": level, "message": strings.TrimRight(message, "\n")}
+	for key, value := range fields {
+		line[key] = value
+	}
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]any{"time": time.Now(), "level": "error", "message": "log line could not be encoded: " + err.Error()})
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	writer.Write(append(encoded, '\n'))
+}
+
+func (l *JSONLeveledLogger) Debugf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelDebug {
+		l.write(l.Output, "debug", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *JSONLeveledLogger) Infof(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelInfo {
+		l.write(l.Output, "info", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *JSONLeveledLogger) Warnf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelWarn {
+		l.write(l.ErrorOutput, "warn", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *JSONLeveledLogger) Errorf(format string, v ...interface{}) {
+	if l.Level >= cloudflare.LevelError {
+		l.write(l.ErrorOutput, "error", fmt.Sprintf(format, v...), nil)
+	}
+}
+
+func (l *JSONLeveledLogger) InfoWith(message string, fields map[string]any) {
+	if l.Level >= cloudflare.LevelInfo {
+		l.write(l.Output, "info", message, fields)
+	}
+}
+
+// RotatingFile is an io.Writer appending to a file, which is rotated to
+// path.1, path.2, ... once it would grow beyond max_size bytes. At most
+// max_backups rotated files are kept.
+type RotatingFile struct {
+	path        string
+	max_size    int64
+	max_backups int
+	mutex       sync.Mutex
+	file        *os.File
+	size        int64
+}
+
+func NewRotatingFile(path string, max_size int64, max_backups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, max_size: max_size, max_backups: max_backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate moves the backups up by one and starts a new file. A backup that
+// could not be moved is returned as an error, the log file is opened again
+// anyway so the logs keep being written.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.max_backups < 1 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	errs := []error{}
+	if err := os.Remove(r.path + "." + strconv.Itoa(r.max_backups)); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	for i := r.max_backups - 1; i >= 1; i-- {
+		if err := os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	if err := r.open(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.max_size > 0 && r.size > 0 && r.size+int64(len(p)) > r.max_size {
+		if err := r.rotate(); err != nil {
+			// the logs can not go to the file they fail to rotate, the
+			// write below fails too if it could not be opened again
+			fmt.Fprintf(os.Stderr, "[error] log file '%s' could not be rotated: %s\n", r.path, err.Error())
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// configureLogLevel switches the logger to debug level if DEBUG is set.
+func (c *CloudflareDDNSUpdaterApplication) configureLogLevel() {
+	if !c.lookupBool(DEBUG) {
+		return
+	}
+	switch logger := c.logger.(type) {
+	case *cloudflare.LeveledLogger:
+		logger.Level = cloudflare.LevelDebug
+	case *WriterLeveledLogger:
+		logger.Level = cloudflare.LevelDebug
+	case *JSONLeveledLogger:
+		logger.Level = cloudflare.LevelDebug
+	}
+	c.debug = true
+	c.logger.Infof("logging at debug level, including the cloudflare api requests\n")
+}
+
+func (c *CloudflareDDNSUpdaterApplication) configureLogging() {
+	log_file, exists := c.lookupEnv(LOG_FILE)
+	if !exists {
+		return
+	}
+
+	max_size := int64(10)
+	if max_size_string, exists := c.lookupEnv(LOG_MAX_SIZE); exists {
+		parsed, err := strconv.ParseInt(max_size_string, 10, 64)
+		if err != nil || parsed < 0 {
+			c.logger.Errorf("log max size '%s' is not a valid number of megabytes\n", max_size_string)
+			c.exit()
+		}
+		max_size = parsed
+	}
+
+	max_backups := 3
+	if max_backups_string, exists := c.lookupEnv(LOG_MAX_BACKUPS); exists {
+		parsed, err := strconv.Atoi(max_backups_string)
+		if err != nil || parsed < 0 {
+			c.logger.Errorf("log max backups '%s' is not a valid number\n", max_backups_string)
+			c.exit()
+		}
+		max_backups = parsed
+	}
+
+	file, err := NewRotatingFile(log_file, max_size*1024*1024, max_backups)
+	if err != nil {
+		c.logger.Errorf("log file '%s' could not be opened: %s\n", log_file, err.Error())
+		c.exit()
+	}
+
+	c.logger.Infof("logging to '%s' (max size %d MB, %d backups)\n", log_file, max_size, max_backups)
+	c.logger = &WriterLeveledLogger{Level: cloudflare.LevelInfo, Writer: file}
+}
+
+// configureLogFormat switches the logger to json lines with LOG_FORMAT=json,
+// keeping its level and outputs.
+func (c *CloudflareDDNSUpdaterApplication) configureLogFormat() {
+	log_format, exists := c.lookupEnv(LOG_FORMAT)
+	if !exists || log_format == "text" {
+		return
+	}
+	if log_format != "json" {
+		c.logger.Errorf("log format '%s' is not supported, use 'text' or 'json'\n", log_format)
+		c.exit()
+	}
+	switch logger := c.logger.(type) {
+	case *cloudflare.LeveledLogger:
+		c.logger = &JSONLeveledLogger{Level: logger.Level, Output: os.Stdout, ErrorOutput: os.Stderr}
+	case *WriterLeveledLogger:
+		c.logger = &JSONLeveledLogger{Level: logger.Level, Output: logger.Writer, ErrorOutput: logger.Writer}
+	}
+	c.log_format = log_format
+}
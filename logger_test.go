@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFileBackupFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ddns.log")
+	r, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile() failed: %s", err.Error())
+	}
+	defer r.file.Close()
+	if _, err := r.Write([]byte("first\n")); err != nil {
+		t.Fatalf("Write() failed: %s", err.Error())
+	}
+	os.WriteFile(path+".1", []byte("backup\n"), 0644)
+	// a directory that is not empty can neither be removed nor replaced
+	if err := os.MkdirAll(filepath.Join(path+".2", "kept"), 0755); err != nil {
+		t.Fatalf("could not create the blocking directory: %s", err.Error())
+	}
+
+	if err := r.rotate(); err == nil {
+		t.Errorf("rotate() succeeded, the oldest backup is a directory that is not empty")
+	}
+	if _, err := r.Write([]byte("second\n")); err != nil {
+		t.Errorf("Write() after the failed rotation failed: %s", err.Error())
+	}
+	if content, _ := os.ReadFile(path); string(content) != "second\n" {
+		t.Errorf("log file is '%s', want only the line written after the rotation", content)
+	}
+	if content, _ := os.ReadFile(path + ".1"); string(content) != "first\n" {
+		t.Errorf("first backup is '%s', want the rotated log file", content)
+	}
+}
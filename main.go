@@ -2,13 +2,22 @@ package main
 
 import (
 	"context"
-	"io"
+	"errors"
+	"flag"
+	"fmt"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
+	"beemo.at/cloudflare-ddns/updater"
 	"github.com/cloudflare/cloudflare-go"
 )
 
@@ -17,170 +26,792 @@ const (
 	ZONE_ENV_VARIABLE_NAME      = "CLOUDFLARE_ZONE_NAME"
 	RECORD_ENV_VARIABLE_NAME    = "CLOUDFLARE_RECORD_NAME"
 	CURRNENT_IP_INFO_ENDPOINT   = "CURRENT_IP_INFO_ENDPOINT"
+	STATSD_ADDRESS              = "STATSD_ADDR"
+	STATSD_PREFIX               = "STATSD_PREFIX"
 	DURATION_BETWEEN_UPDATES    = "DURATION_BETWEEN_UPDATES"
+	IP_FAMILY                   = "IP_FAMILY"
+	SKIP_STARTUP_PROBE          = "SKIP_STARTUP_PROBE"
+	IPV4_INTERVAL               = "IPV4_INTERVAL"
+	IPV6_INTERVAL               = "IPV6_INTERVAL"
+	RECORD_SELECTOR_COMMENT     = "RECORD_SELECTOR_COMMENT"
+	STATUS_FILE                 = "STATUS_FILE"
+	SKIP_CGNAT                  = "SKIP_CGNAT"
+	WWW_CNAME                   = "WWW_CNAME"
+	CHANGE_DEBOUNCE_COUNT       = "CHANGE_DEBOUNCE_COUNT"
+	CIRCUIT_BREAKER_THRESHOLD   = "CIRCUIT_BREAKER_THRESHOLD"
+	CIRCUIT_BREAKER_COOLDOWN    = "CIRCUIT_BREAKER_COOLDOWN"
+	RECORD_TYPE                 = "RECORD_TYPE"
+	CNAME_TARGET                = "CNAME_TARGET"
+	IP_MAX_RETRIES              = "IP_MAX_RETRIES"
+	IP_RETRY_DELAY              = "IP_RETRY_DELAY"
+	API_MAX_RETRIES             = "API_MAX_RETRIES"
+	API_RETRY_DELAY             = "API_RETRY_DELAY"
+	ZONE_LOOKUP_RETRIES         = "ZONE_LOOKUP_RETRIES"
+	ZONE_LOOKUP_RETRY_DELAY     = "ZONE_LOOKUP_RETRY_DELAY"
+	RECONCILE_DUPLICATES        = "RECONCILE_DUPLICATES"
+	RECORD_UPDATE_STAGGER       = "RECORD_UPDATE_STAGGER"
+	CLOUDFLARE_PROXIED          = "CLOUDFLARE_PROXIED"
+	IP_MAX_REDIRECTS            = "IP_MAX_REDIRECTS"
+	IP_SOURCE                   = "IP_SOURCE"
+	RESOLVE_HOSTNAME            = "RESOLVE_HOSTNAME"
+	RECORD_ALIASES              = "RECORD_ALIASES"
+	ADAPTIVE_TTL                = "ADAPTIVE_TTL"
+	CLOUDFLARE_ACCOUNT_ID       = "CLOUDFLARE_ACCOUNT_ID"
+	CLOUDFLARE_ZONE_ID          = "CLOUDFLARE_ZONE_ID"
+	CLOUDFLARE_RECORD_ID        = "CLOUDFLARE_RECORD_ID"
+	RECORD_NAME_LITERAL         = "RECORD_NAME_LITERAL"
+	CYCLE_BUDGET                = "CYCLE_BUDGET"
+	UPDATE_WINDOW               = "UPDATE_WINDOW"
+	IGNORE_IPS                  = "IGNORE_IPS"
+	RESTORE_ONLY                = "RESTORE_ONLY"
+	CREATE_MISSING              = "CREATE_MISSING"
+	IPV4_CREATE_MISSING         = "IPV4_CREATE_MISSING"
+	IPV6_CREATE_MISSING         = "IPV6_CREATE_MISSING"
+	MULTI_RECORD_STRATEGY       = "MULTI_RECORD_STRATEGY"
+	RESOLVE_CACHE_TTL           = "RESOLVE_CACHE_TTL"
+	STRICT_TLS                  = "STRICT_TLS"
+	LOOKUP_STRATEGY             = "LOOKUP_STRATEGY"
+	RECORD_MIRRORS              = "RECORD_MIRRORS"
+	RESPECT_TTL                 = "RESPECT_TTL"
+	INSTANCE_ID                 = "INSTANCE_ID"
+	ALLOW_MAPPED_IPV6           = "ALLOW_MAPPED_IPV6"
+	SKIP_BLOCKED_RECORDS        = "SKIP_BLOCKED_RECORDS"
+	RESOLVE_AUTHORITATIVE       = "RESOLVE_AUTHORITATIVE"
+	IP_INTERFACE                = "IP_INTERFACE"
+	PREFER_TEMPORARY            = "PREFER_TEMPORARY"
+	BATCH_LOOKUP                = "BATCH_LOOKUP"
+	ZONE_CONCURRENCY            = "ZONE_CONCURRENCY"
+	MIRROR_CONCURRENCY          = "MIRROR_CONCURRENCY"
+	CURRENT_IP                  = "CURRENT_IP"
+	DETECT_NOOP_UPDATES         = "DETECT_NOOP_UPDATES"
+	WAIT_FOR_NETWORK            = "WAIT_FOR_NETWORK"
+	EXPECTED_GATEWAY_MAC        = "EXPECTED_GATEWAY_MAC"
+	RECONCILE_ON_START          = "RECONCILE_ON_START"
+	SHUFFLE_RECORD_ORDER        = "SHUFFLE_RECORD_ORDER"
+	SKIP_FAMILY_MISMATCH        = "SKIP_FAMILY_MISMATCH"
+	HA_LOCK                     = "HA_LOCK"
+	IPV6_HOST_SUFFIX            = "IPV6_HOST_SUFFIX"
+	IP_CACHE_TTL                = "IP_CACHE_TTL"
+	RECONCILE_SETTINGS          = "RECONCILE_SETTINGS"
+	RECORD_TTL                  = "RECORD_TTL"
+	RECORD_COMMENT              = "RECORD_COMMENT"
 )
 
 type CloudflareDDNSUpdaterApplication struct {
-	api_token      string
-	ip_info_url    string
-	zone_name      string
-	record_name    string
-	sleep_interval time.Duration
-	context        context.Context
-	cancel         context.CancelFunc
-	logger         *cloudflare.LeveledLogger
-	api            *cloudflare.API
+	config      updater.Config
+	config_file map[string]string
+	status_file string
+	context     context.Context
+	cancel      context.CancelFunc
+	logger      cloudflare.LeveledLoggerInterface
+	updater     *updater.Updater
+	statsd      *StatsD
+	history     *History
+	publishers  []Publisher
+
+	// notify_template renders the message of change events, see ChangeEvent
+	notify_template *template.Template
+	// notify_queues publish the change events of each publisher, see NotifyQueue
+	notify_queues []*NotifyQueue
+	// notify_timeout bounds publishing a change event, see NOTIFY_TIMEOUT
+	notify_timeout time.Duration
+	// publisher_sources are the urls of the publishers, by their index
+	publisher_sources []publisherSource
+
+	// history_db records the history in a sqlite file with HISTORY_DB
+	history_db *HistoryDB
+
+	// list_records only needs the zone, see listRecords
+	list_records bool
+
+	// debug logs at debug level, see configureLogLevel
+	debug bool
+
+	// log_format is "json" with LOG_FORMAT=json, see configureLogFormat
+	log_format string
+	// stdout_output is set if a command prints its output to stdout
+	stdout_output bool
+
+	// events are written to stdout with EVENTS_NDJSON, see configureEvents
+	events *EventWriter
+
+	metrics *MetricsFile
+
+	// wait_for_network retries initializing for this long, see initialize
+	wait_for_network time.Duration
+
+	health_listen_address string
+	health_listen_network string
+	ready                 atomic.Bool
+	health_check_interval time.Duration
+	missing_records       atomic.Value
+
+	// log_buffer is nil unless /logs is enabled, see configureLogBuffer
+	log_buffer *LogBuffer
+	logs_token atomic.Value
+
+	status_mutex sync.Mutex
+	status       map[string]StatusSnapshot
 }
 
 func (c *CloudflareDDNSUpdaterApplication) configure() {
 	c.logger.Infof("CLOUDFLARE DDNS configuration started " + strings.Repeat("-", 12) + "\n")
 
-	if api_token, exists := os.LookupEnv(API_TOKEN_ENV_VARIABLE_NAME); exists {
-		c.api_token = api_token
+	if api_token, exists := c.lookupEnv(API_TOKEN_ENV_VARIABLE_NAME); exists {
+		c.config.APIToken = api_token
+		c.log_buffer.Redact(api_token)
 	} else {
 		c.logger.Errorf("no API token found in env var '%s'\n", API_TOKEN_ENV_VARIABLE_NAME)
 		c.exit()
 	}
 
-	if zone_name, exists := os.LookupEnv(ZONE_ENV_VARIABLE_NAME); exists {
-		c.zone_name = zone_name
-	} else {
-		c.logger.Errorf("no zone name found in env var '%s'\n", ZONE_ENV_VARIABLE_NAME)
+	if zone_id, exists := c.lookupEnv(CLOUDFLARE_ZONE_ID); exists {
+		c.config.ZoneID = zone_id
+	}
+	if zone_name, exists := c.lookupEnv(ZONE_ENV_VARIABLE_NAME); exists {
+		c.config.ZoneName = zone_name
+	} else if c.config.ZoneID == "" {
+		c.logger.Errorf("no zone name found in env var '%s' and no zone id in env var '%s'\n", ZONE_ENV_VARIABLE_NAME, CLOUDFLARE_ZONE_ID)
 		c.exit()
 	}
 
-	if record_name, exists := os.LookupEnv("CLOUDFLARE_RECORD_NAME"); exists {
-		c.record_name = record_name
-	} else {
+	if account_id, exists := c.lookupEnv(CLOUDFLARE_ACCOUNT_ID); exists {
+		c.logger.Infof("looking up zone '%s' in account '%s'\n", c.config.ZoneName, account_id)
+		c.config.AccountID = account_id
+	}
+
+	if record_id, exists := c.lookupEnv(CLOUDFLARE_RECORD_ID); exists {
+		c.config.RecordID = record_id
+	}
+	if record_comment, exists := c.lookupEnv(RECORD_SELECTOR_COMMENT); exists {
+		c.config.RecordComment = record_comment
+		c.logger.Infof("updating all records with the comment '%s'\n", record_comment)
+	} else if record_name, exists := c.lookupEnv("CLOUDFLARE_RECORD_NAME"); exists {
+		c.config.RecordName = record_name
+	} else if c.config.RecordID == "" && !c.list_records {
 		c.logger.Errorf("no record name found in env var '%s'\n", RECORD_ENV_VARIABLE_NAME)
 		c.exit()
 	}
 
-	if custom_ip_info_url, exists := os.LookupEnv(CURRNENT_IP_INFO_ENDPOINT); exists {
-		c.ip_info_url = custom_ip_info_url
-	} else {
-		c.ip_info_url = "https://icanhazip.com"
+	c.config.LiteralRecordName = c.lookupBool(RECORD_NAME_LITERAL)
+
+	if lookup_strategy, exists := c.lookupEnv(LOOKUP_STRATEGY); exists {
+		switch lookup_strategy {
+		case updater.LookupList, updater.LookupResolve, updater.LookupID:
+			c.logger.Infof("lookup strategy was specified as '%s'\n", lookup_strategy)
+			c.config.LookupStrategy = lookup_strategy
+		default:
+			c.logger.Errorf("lookup strategy '%s' is not supported, use 'list', 'resolve' or 'id'\n", lookup_strategy)
+			c.exit()
+		}
 	}
 
-	if duration_string, exists := os.LookupEnv(DURATION_BETWEEN_UPDATES); exists {
-		duration, err := time.ParseDuration(duration_string)
-		if err != nil {
-			c.logger.Errorf("custom duration between updates '%s' could not be parsed: '%s'\n", duration_string, err.Error())
+	c.config.ResolveAuthoritative = c.lookupBool(RESOLVE_AUTHORITATIVE)
+	if c.config.ResolveAuthoritative && c.config.LookupStrategy != updater.LookupResolve {
+		c.logger.Errorf("env var '%s' requires env var '%s' to be '%s'\n", RESOLVE_AUTHORITATIVE, LOOKUP_STRATEGY, updater.LookupResolve)
+		c.exit()
+	}
+
+	if strategy, exists := c.lookupEnv(MULTI_RECORD_STRATEGY); exists {
+		switch strategy {
+		case "last", "first", "all", "error", "skip":
+			c.logger.Infof("multi record strategy was specified as '%s'\n", strategy)
+			c.config.MultiRecordStrategy = strategy
+		default:
+			c.logger.Errorf("multi record strategy '%s' is not supported, use 'last', 'first', 'all', 'error' or 'skip'\n", strategy)
 			c.exit()
 		}
-		c.logger.Infof("custom duration betwwen updates was specified as '%s', using %s\n", duration_string, duration.String())
-		c.sleep_interval = duration
-	} else {
-		c.sleep_interval = 5 * time.Minute
 	}
 
-	c.logger.Infof("CLOUDFLARE DDNS configuration finished " + strings.Repeat("-", 11) + "\n")
-}
+	// RECONCILE_DUPLICATES names the multi record strategies by what they do
+	// to duplicates
+	if policy, exists := c.lookupEnv(RECONCILE_DUPLICATES); exists {
+		if _, exists := c.lookupEnv(MULTI_RECORD_STRATEGY); exists {
+			c.logger.Errorf("env vars '%s' and '%s' can not be combined\n", RECONCILE_DUPLICATES, MULTI_RECORD_STRATEGY)
+			c.exit()
+		}
+		strategy, valid := map[string]string{"collapse": "all", "first": "first", "skip": "skip"}[policy]
+		if !valid {
+			c.logger.Errorf("duplicate policy '%s' is not supported, use 'collapse', 'first' or 'skip'\n", policy)
+			c.exit()
+		}
+		c.logger.Infof("duplicate records are reconciled with policy '%s'\n", policy)
+		c.config.MultiRecordStrategy = strategy
+	}
 
-func (c *CloudflareDDNSUpdaterApplication) initialize() {
-	c.logger.Infof("CLOUDFLARE DDNS initialization started " + strings.Repeat("-", 11) + "\n")
+	if record_aliases, exists := c.lookupEnv(RECORD_ALIASES); exists {
+		for _, entry := range updater.SplitList(record_aliases) {
+			alias, enabled := c.cutEnabled(entry)
+			if !enabled {
+				c.logger.Debugf("alias '%s' is disabled, skipping it\n", alias)
+				continue
+			}
+			if alias != "" {
+				c.config.RecordAliases = append(c.config.RecordAliases, alias)
+			}
+		}
+		c.logger.Infof("updating the aliases %v together with the record\n", c.config.RecordAliases)
+	}
 
-	api, err := cloudflare.NewWithAPIToken(c.api_token)
+	c.config.ShuffleRecordOrder = c.lookupBool(SHUFFLE_RECORD_ORDER)
+	if c.config.ShuffleRecordOrder {
+		c.logger.Infof("starting every update with the next record in turn\n")
+	}
+
+	c.config.BatchLookup = c.lookupBool(BATCH_LOOKUP)
+	if c.config.BatchLookup {
+		c.logger.Infof("looking up the record and its aliases with a single list of the zone\n")
+	}
+
+	if record_mirrors, exists := c.lookupEnv(RECORD_MIRRORS); exists {
+		for _, entry := range updater.SplitList(record_mirrors) {
+			mirror_string, enabled := c.cutEnabled(entry)
+			zone, record, valid := strings.Cut(mirror_string, ":")
+			if !valid || zone == "" || record == "" {
+				c.logger.Errorf("record mirror '%s' is not of the form zone:record\n", entry)
+				c.exit()
+			}
+			if !enabled {
+				c.logger.Debugf("record mirror '%s' is disabled, skipping it\n", mirror_string)
+				continue
+			}
+			mirror := updater.Mirror{Zone: zone, Record: record}
+			c.logger.Infof("mirroring the record to '%s'\n", mirror.String())
+			c.config.Mirrors = append(c.config.Mirrors, mirror)
+		}
+	}
+
+	// MIRROR_CONCURRENCY is an alias of ZONE_CONCURRENCY kept for existing
+	// configs, only one of them may be set
+	concurrency_name := ZONE_CONCURRENCY
+	concurrency_string, exists := c.lookupEnv(ZONE_CONCURRENCY)
+	if alias_string, alias_exists := c.lookupEnv(MIRROR_CONCURRENCY); alias_exists {
+		if exists {
+			c.logger.Errorf("env vars '%s' and '%s' both set the zone concurrency, only set '%s'\n", ZONE_CONCURRENCY, MIRROR_CONCURRENCY, ZONE_CONCURRENCY)
+			c.exit()
+		}
+		concurrency_name, concurrency_string, exists = MIRROR_CONCURRENCY, alias_string, true
+	}
+	if exists {
+		concurrency, err := strconv.Atoi(concurrency_string)
+		if err != nil || concurrency < 1 {
+			c.logger.Errorf("value '%s' of env var '%s' is not a positive number of zones\n", concurrency_string, concurrency_name)
+			c.exit()
+		}
+		if len(c.config.Mirrors) < 1 {
+			c.logger.Warnf("'%s' applies to the zones of '%s', which has no mirrors, so there is only one zone to work on\n", concurrency_name, RECORD_MIRRORS)
+		}
+		c.logger.Infof("working on up to %d zones at once\n", concurrency)
+		c.config.ZoneConcurrency = concurrency
+	}
+
+	ip_info_endpoints := "https://icanhazip.com"
+	if custom_ip_info_endpoints, exists := c.lookupEnv(CURRNENT_IP_INFO_ENDPOINT); exists {
+		ip_info_endpoints = custom_ip_info_endpoints
+	}
+	endpoints, err := updater.ParseIPEndpoints(ip_info_endpoints)
 	if err != nil {
-		c.logger.Errorf("could not create cloudflare api client with the provided token, %s\n", err.Error())
+		c.logger.Errorf("current ip info endpoints '%s' could not be parsed: %s\n", ip_info_endpoints, err.Error())
 		c.exit()
 	}
-	c.api = api
+	c.config.Endpoints = endpoints
 
-	_, err = http.Get(c.ip_info_url)
+	if ignore_ips, exists := c.lookupEnv(IGNORE_IPS); exists {
+		ignored, err := updater.ParseIPNets(ignore_ips)
+		if err != nil {
+			c.logger.Errorf("ignored ips '%s' could not be parsed: %s\n", ignore_ips, err.Error())
+			c.exit()
+		}
+		c.logger.Infof("treating the addresses %s as detection failures\n", ignore_ips)
+		c.config.IgnoreIPs = ignored
+	}
 
-	if err != nil {
-		c.logger.Errorf("current ip info endpoint '%s' could not be requested: %s\n", c.ip_info_url, err.Error())
+	if ip_source, exists := c.lookupEnv(IP_SOURCE); exists {
+		switch ip_source {
+		case "endpoint":
+		case "resolve":
+			resolve_hostname, exists := c.lookupEnv(RESOLVE_HOSTNAME)
+			if !exists {
+				c.logger.Errorf("ip source 'resolve' requires a hostname in env var '%s'\n", RESOLVE_HOSTNAME)
+				c.exit()
+			}
+			c.logger.Infof("taking the current ip from resolving '%s'\n", resolve_hostname)
+			c.config.ResolveHostname = resolve_hostname
+		case "interface":
+			ip_interface, exists := c.lookupEnv(IP_INTERFACE)
+			if !exists {
+				c.logger.Errorf("ip source 'interface' requires an interface name in env var '%s'\n", IP_INTERFACE)
+				c.exit()
+			}
+			c.config.PreferTemporary = c.lookupBool(PREFER_TEMPORARY)
+			c.logger.Infof("taking the current ip from the addresses of interface '%s' (preferring temporary IPv6 addresses: %t)\n", ip_interface, c.config.PreferTemporary)
+			c.config.Interface = ip_interface
+		case "env":
+			if _, exists := c.lookupEnv(CURRENT_IP); !exists {
+				c.logger.Errorf("ip source 'env' requires the ip in env var '%s' or a file named by '%s'\n", CURRENT_IP, CURRENT_IP+"_FILE")
+				c.exit()
+			}
+			c.logger.Infof("taking the current ip from env var '%s'\n", CURRENT_IP)
+			c.config.CurrentIP = c.readCurrentIP
+		default:
+			c.logger.Errorf("ip source '%s' is not supported, use 'endpoint', 'resolve', 'interface' or 'env'\n", ip_source)
+			c.exit()
+		}
 	}
 
-	c.logger.Infof("CLOUDFLARE DDNS initialization finished " + strings.Repeat("-", 10) + "\n")
-}
+	c.config.StrictTLS = c.lookupBool(STRICT_TLS)
 
-func (c *CloudflareDDNSUpdaterApplication) update(ctx context.Context) {
-	c.logger.Infof("CLOUDFLARE DDNS update started " + strings.Repeat("-", 19) + "\n")
+	c.config.AllowMappedIPv6 = c.lookupBool(ALLOW_MAPPED_IPV6)
+	if c.config.AllowMappedIPv6 {
+		c.logger.Infof("accepting IPv4-mapped addresses for AAAA records\n")
+	}
 
-	ip_response, err := http.Get(c.ip_info_url)
+	if cache_ttl, exists := c.lookupDuration(RESOLVE_CACHE_TTL); exists {
+		c.logger.Infof("caching the addresses of the ip info endpoints for %s\n", cache_ttl.String())
+		c.config.ResolveCacheTTL = cache_ttl
+	}
 
-	if err != nil {
-		c.logger.Errorf("error when requesting the current ip from '%s': %s\n", c.ip_info_url, err.Error())
-		c.exit()
+	if max_redirects_string, exists := c.lookupEnv(IP_MAX_REDIRECTS); exists {
+		max_redirects, err := strconv.Atoi(max_redirects_string)
+		if err != nil || max_redirects < 0 {
+			c.logger.Errorf("ip max redirects '%s' is not a non-negative number\n", max_redirects_string)
+			c.exit()
+		}
+		c.logger.Infof("following at most %d redirects of the ip info endpoints\n", max_redirects)
+		c.config.IPMaxRedirects = max_redirects
+		if max_redirects == 0 {
+			c.config.IPMaxRedirects = -1
+		}
 	}
 
-	ip_bytes, err := io.ReadAll(ip_response.Body)
+	if ip_family, exists := c.lookupEnv(IP_FAMILY); exists {
+		switch ip_family {
+		case "4", "6":
+			c.config.Families = []string{ip_family}
+			c.logger.Infof("ip family was specified as '%s', fetching the current ip over IPv%s\n", ip_family, ip_family)
+		case "dual":
+			c.config.Families = []string{"4", "6"}
+			c.logger.Infof("dual-stack was specified, maintaining both the A and the AAAA record\n")
+		default:
+			c.logger.Errorf("ip family '%s' is not supported, use '4', '6' or 'dual'\n", ip_family)
+			c.exit()
+		}
+	}
 
-	if err != nil {
-		c.logger.Errorf("error reading the body of the ip request response: %s\n", err.Error())
-		c.exit()
+	if record_type, exists := c.lookupEnv(RECORD_TYPE); exists {
+		if record_type != "A" && record_type != "AAAA" {
+			c.logger.Errorf("record type '%s' is not supported, use 'A' or 'AAAA'\n", record_type)
+			c.exit()
+		}
+		c.logger.Infof("record type was specified as '%s'\n", record_type)
+		c.config.RecordType = record_type
 	}
 
-	current_ip := net.ParseIP(strings.TrimSpace(string(ip_bytes)))
+	if duration, exists := c.lookupDuration(DURATION_BETWEEN_UPDATES); exists {
+		c.logger.Infof("custom duration betwwen updates was specified, using %s\n", duration.String())
+		c.config.Interval = duration
+	} else {
+		c.config.Interval = 5 * time.Minute
+	}
 
-	if current_ip == nil {
-		c.logger.Errorf("current IP address could not be parsed from '%s'\n", string(ip_bytes))
-		c.exit()
+	c.config.Intervals = map[string]time.Duration{}
+	for family, name := range map[string]string{"4": IPV4_INTERVAL, "6": IPV6_INTERVAL} {
+		if duration, exists := c.lookupDuration(name); exists {
+			c.logger.Infof("custom IPv%s interval was specified, using %s\n", family, duration.String())
+			c.config.Intervals[family] = duration
+		}
 	}
 
-	c.logger.Infof("current IP address is %s\n", current_ip.String())
+	c.config.SkipProbe = c.lookupBool(SKIP_STARTUP_PROBE)
+	c.config.SkipCGNAT = c.lookupBool(SKIP_CGNAT)
+	c.config.ReconcileOnStart = c.lookupBool(RECONCILE_ON_START)
+	c.config.SkipFamilyMismatch = c.lookupBool(SKIP_FAMILY_MISMATCH)
 
-	zones, err := c.api.ListZones(ctx, c.zone_name)
+	if ttl, exists := c.lookupDuration(IP_CACHE_TTL); exists {
+		c.logger.Infof("reusing the fetched ip for %s, a changed ip may be noticed that much later\n", ttl.String())
+		c.config.IPCacheTTL = ttl
+	}
 
-	if err != nil {
-		c.logger.Errorf("could not list zones: %s\n", err.Error())
-		c.exit()
+	if suffix_string, exists := c.lookupEnv(IPV6_HOST_SUFFIX); exists {
+		suffix, err := updater.ParseHostSuffix(suffix_string)
+		if err != nil {
+			c.logger.Errorf("IPv6 host suffix '%s' is invalid: %s\n", suffix_string, err.Error())
+			c.exit()
+		}
+		c.logger.Infof("using only the prefix of detected IPv6 addresses with host suffix %s\n", suffix.String())
+		c.config.IPv6HostSuffix = suffix
 	}
 
-	if len(zones) < 1 {
-		c.logger.Errorf("no zones found for '%s'\n", c.zone_name)
-		c.exit()
+	if mac_string, exists := c.lookupEnv(EXPECTED_GATEWAY_MAC); exists {
+		mac, err := net.ParseMAC(mac_string)
+		if err != nil {
+			c.logger.Errorf("expected gateway mac address '%s' is invalid: %s\n", mac_string, err.Error())
+			c.exit()
+		}
+		c.logger.Infof("only updating while the default gateway is %s\n", mac.String())
+		c.config.ExpectedGatewayMAC = mac
 	}
 
-	rc := cloudflare.ZoneIdentifier(zones[len(zones)-1].ID)
+	if debounce_string, exists := c.lookupEnv(CHANGE_DEBOUNCE_COUNT); exists {
+		debounce, err := strconv.Atoi(debounce_string)
+		if err != nil || debounce < 1 {
+			c.logger.Errorf("change debounce count '%s' is not a positive number\n", debounce_string)
+			c.exit()
+		}
+		c.logger.Infof("applying ip changes once they were detected %d times in a row\n", debounce)
+		c.config.ChangeDebounceCount = debounce
+	}
 
-	records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
-		Type: "A",
-		Name: c.record_name,
-	})
+	if threshold_string, exists := c.lookupEnv(CIRCUIT_BREAKER_THRESHOLD); exists {
+		threshold, err := strconv.Atoi(threshold_string)
+		if err != nil || threshold < 1 {
+			c.logger.Errorf("circuit breaker threshold '%s' is not a positive number\n", threshold_string)
+			c.exit()
+		}
+		c.config.CircuitBreakerThreshold = threshold
+	}
 
-	if err != nil {
-		c.logger.Errorf("could not list records for '%s': %s\n", c.record_name, err.Error())
-		c.exit()
+	if cooldown, exists := c.lookupDuration(CIRCUIT_BREAKER_COOLDOWN); exists {
+		c.config.CircuitBreakerCooldown = cooldown
+	}
+
+	if budget, exists := c.lookupDuration(CYCLE_BUDGET); exists {
+		c.logger.Infof("abandoning updates taking longer than %s\n", budget.String())
+		c.config.CycleBudget = budget
+	}
+
+	c.config.IPMaxRetries, c.config.IPRetryDelay = c.lookupRetries(IP_MAX_RETRIES, IP_RETRY_DELAY)
+	c.config.APIMaxRetries, c.config.APIRetryDelay = c.lookupRetries(API_MAX_RETRIES, API_RETRY_DELAY)
+	c.config.ZoneLookupRetries, c.config.ZoneLookupRetryDelay = c.lookupRetries(ZONE_LOOKUP_RETRIES, ZONE_LOOKUP_RETRY_DELAY)
+
+	if window_string, exists := c.lookupEnv(UPDATE_WINDOW); exists {
+		window, err := updater.ParseUpdateWindow(window_string)
+		if err != nil {
+			c.logger.Errorf("%s\n", err.Error())
+			c.exit()
+		}
+		c.logger.Infof("only updating records during '%s'\n", window.String())
+		c.config.UpdateWindow = window
+	}
+
+	if stagger, exists := c.lookupDuration(RECORD_UPDATE_STAGGER); exists {
+		c.logger.Infof("waiting %s between updating two records\n", stagger.String())
+		c.config.RecordUpdateStagger = stagger
+	}
+
+	c.configureClientOptions()
+
+	if status_file, exists := c.lookupEnv(STATUS_FILE); exists {
+		c.status_file = status_file
+		c.config.CachedZoneID = c.readStatusZoneID()
+	}
+
+	if cname_target, exists := c.lookupEnv(CNAME_TARGET); exists {
+		c.logger.Infof("maintaining '%s' as a CNAME pointing at '%s' instead of the current ip\n", c.config.RecordName, cname_target)
+		c.config.CNAMETarget = cname_target
+	}
+
+	c.config.ExpectProxied = c.lookupBool(CLOUDFLARE_PROXIED)
+
+	c.config.RestoreOnly = c.lookupBool(RESTORE_ONLY)
+	if c.config.RestoreOnly {
+		c.logger.Infof("restore-only mode, only creating missing records and never updating existing ones\n")
+	}
+
+	// CREATE_MISSING applies to both record types, IPV4_ and IPV6_CREATE_MISSING
+	// override it per type
+	create_missing := c.lookupBool(CREATE_MISSING)
+	c.config.CreateMissing = map[string]bool{"A": create_missing, "AAAA": create_missing}
+	for record_type, name := range map[string]string{"A": IPV4_CREATE_MISSING, "AAAA": IPV6_CREATE_MISSING} {
+		if _, exists := c.lookupEnv(name); exists {
+			c.config.CreateMissing[record_type] = c.lookupBool(name)
+		}
+	}
+	for _, record_type := range []string{"A", "AAAA"} {
+		if c.config.CreateMissing[record_type] {
+			c.logger.Infof("creating missing %s records\n", record_type)
+		}
+	}
+
+	c.config.ReconcileSettings = c.lookupBool(RECONCILE_SETTINGS)
+	if ttl_string, exists := c.lookupEnv(RECORD_TTL); exists {
+		ttl, err := strconv.Atoi(ttl_string)
+		if err != nil || ttl != 1 && (ttl < 30 || ttl > 86400) {
+			c.logger.Errorf("record ttl '%s' is not 1 (automatic) or a number of seconds between 30 and 86400\n", ttl_string)
+			c.exit()
+		}
+		c.config.RecordTTL = ttl
+	}
+	if desired_comment, exists := c.lookupEnv(RECORD_COMMENT); exists {
+		c.config.DesiredComment = desired_comment
+	}
+	if c.config.ReconcileSettings {
+		c.logger.Infof("reconciling the proxied flag, ttl and comment of the records too\n")
+	}
+
+	c.config.AdaptiveTTL = c.lookupBool(ADAPTIVE_TTL)
+	if c.config.AdaptiveTTL {
+		c.logger.Infof("lowering the ttl of changed records until their content is stable again\n")
+	}
+
+	c.config.SkipBlocked = c.lookupBool(SKIP_BLOCKED_RECORDS)
+	if c.config.SkipBlocked {
+		c.logger.Infof("skipping locked records and records of a paused zone instead of failing\n")
+	}
+
+	c.config.DetectNoop = c.lookupBool(DETECT_NOOP_UPDATES)
+	if c.config.DetectNoop {
+		c.logger.Infof("reporting updates that did not modify a record as no-ops\n")
+	}
+
+	c.config.RespectTTL = c.lookupBool(RESPECT_TTL)
+	if c.config.RespectTTL {
+		c.logger.Infof("not writing records again within their ttl unless the ip changed\n")
+	}
+
+	if instance_id, exists := c.lookupEnv(INSTANCE_ID); exists {
+		c.logger.Infof("stamping instance id '%s' into the comment of written records\n", instance_id)
+		c.config.InstanceID = instance_id
+	}
+
+	if lock, exists := c.lookupEnv(HA_LOCK); exists {
+		if c.config.InstanceID == "" {
+			c.logger.Errorf("env var '%s' requires env var '%s' to tell the replicas apart\n", HA_LOCK, INSTANCE_ID)
+			c.exit()
+		}
+		c.logger.Infof("only updating while holding lock '%s'\n", lock)
+		c.config.HALock = lock
 	}
 
-	if len(records) < 1 {
-		c.logger.Errorf("no A records found for '%s'\n", c.record_name)
+	c.config.WWWCNAME = c.lookupBool(WWW_CNAME)
+	if c.config.WWWCNAME && c.config.RecordComment != "" {
+		c.logger.Errorf("env var '%s' requires the apex record to be given by name, not by comment\n", WWW_CNAME)
 		c.exit()
 	}
 
-	c.logger.Infof("current content of '%s' in zone '%s' is %s\n", c.record_name, c.zone_name, records[len(records)-1].Content)
+	if statsd_address, exists := c.lookupEnv(STATSD_ADDRESS); exists {
+		statsd_prefix, _ := c.lookupEnv(STATSD_PREFIX)
+		statsd, err := NewStatsD(statsd_address, statsd_prefix)
+		if err != nil {
+			c.logger.Errorf("statsd address '%s' could not be used: %s\n", statsd_address, err.Error())
+			c.exit()
+		}
+		c.logger.Infof("emitting statsd metrics to '%s'\n", statsd_address)
+		c.statsd = statsd
+	}
+
+	if metrics_file, exists := c.lookupEnv(METRICS_FILE); exists && metrics_file != "" {
+		c.logger.Infof("writing metrics to file '%s' after every update\n", metrics_file)
+		c.metrics = NewMetricsFile(metrics_file)
+	}
 
-	if records[len(records)-1].Content != current_ip.String() {
-		c.logger.Infof("record is not up-to-date, updating...\n")
-		updated_record, err := c.api.UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{
-			ID:      records[len(records)-1].ID,
-			Content: current_ip.String(),
-		})
+	c.configurePublishers()
 
+	history_size := 20
+	if history_size_string, exists := c.lookupEnv(HISTORY_SIZE); exists {
+		parsed, err := strconv.Atoi(history_size_string)
+		if err != nil || parsed < 1 {
+			c.logger.Errorf("history size '%s' is not a positive number\n", history_size_string)
+			c.exit()
+		}
+		history_size = parsed
+	}
+	c.history = NewHistory(history_size)
+
+	if history_db_path, exists := c.lookupEnv(HISTORY_DB); exists && history_db_path != "" {
+		history_db, err := OpenHistoryDB(history_db_path)
 		if err != nil {
-			c.logger.Errorf("could not update record '%s' in zone '%s': %s\n", c.record_name, c.zone_name, err)
+			c.logger.Errorf("history database '%s' could not be opened: %s\n", history_db_path, err.Error())
 			c.exit()
 		}
-		c.logger.Infof("record has been successfully updated: %+v\n", updated_record, c.sleep_interval.String())
+		c.logger.Infof("recording the history in sqlite database '%s'\n", history_db_path)
+		c.history_db = history_db
+	}
+
+	if health_listen_address, exists := c.lookupEnv(HEALTH_LISTEN_ADDRESS); exists {
+		c.health_listen_address = health_listen_address
+	}
 
+	if health_listen_network, exists := c.lookupEnv(HEALTH_LISTEN_NETWORK); exists {
+		if health_listen_network != "tcp" && health_listen_network != "unix" {
+			c.logger.Errorf("health listen network '%s' is not supported, use 'tcp' or 'unix'\n", health_listen_network)
+			c.exit()
+		}
+		c.health_listen_network = health_listen_network
 	} else {
-		c.logger.Infof("record is already up-to-date @ %s\n", time.Now().String())
+		c.health_listen_network = "tcp"
 	}
 
-	c.logger.Infof("CLOUDFLARE DDNS update finished " + strings.Repeat("-", 18) + "\n")
+	if wait, exists := c.lookupDuration(WAIT_FOR_NETWORK); exists {
+		c.logger.Infof("waiting up to %s for the network at startup\n", wait.String())
+		c.wait_for_network = wait
+	}
+
+	if interval, exists := c.lookupDuration(HEALTH_CHECK_INTERVAL); exists {
+		if interval < c.config.Interval {
+			c.logger.Warnf("health check interval %s is shorter than the update interval %s, it is meant to run less often\n", interval.String(), c.config.Interval.String())
+		}
+		c.logger.Infof("checking that the managed records still exist every %s\n", interval.String())
+		c.health_check_interval = interval
+	}
+
+	c.logConfigSummary()
+	c.logger.Infof("CLOUDFLARE DDNS configuration finished " + strings.Repeat("-", 11) + "\n")
+}
+
+func (c *CloudflareDDNSUpdaterApplication) initialize() {
+	c.logger.Infof("CLOUDFLARE DDNS initialization started " + strings.Repeat("-", 11) + "\n")
+
+	c.status = map[string]StatusSnapshot{}
+	c.config.Logger = c.logger
+	c.config.OnResult = c.onResult
+	c.config.OnCircuitStateChange = func(state string) {
+		c.count("circuit." + state)
+		c.writeMetrics()
+	}
+
+	u, err := updater.New(c.config)
+	// at boot the network may come up after us, so with WAIT_FOR_NETWORK
+	// failures are retried with a backoff, except for a rejected token
+	deadline, delay := time.Now().Add(c.wait_for_network), time.Second
+	for err != nil && !isRejected(err) && time.Now().Add(delay).Before(deadline) {
+		c.logger.Warnf("initialization failed, retrying in %s: %s\n", delay.String(), err.Error())
+		select {
+		case <-c.context.Done():
+			c.exit()
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+		u, err = updater.New(c.config)
+	}
+	if err != nil {
+		c.logger.Errorf("%s\n", err.Error())
+		c.exit()
+	}
+	c.updater = u
+
+	c.logger.Infof("CLOUDFLARE DDNS initialization finished " + strings.Repeat("-", 10) + "\n")
+}
+
+// isRejected reports whether an error is cloudflare rejecting the api token,
+// which waiting for the network does not fix.
+func isRejected(err error) bool {
+	var authentication_error *cloudflare.AuthenticationError
+	var authorization_error *cloudflare.AuthorizationError
+	return errors.As(err, &authentication_error) || errors.As(err, &authorization_error)
+}
+
+func (c *CloudflareDDNSUpdaterApplication) onResult(result updater.Result, err error) {
+	c.timing("update.duration", result.Duration)
+	c.metrics.Observe(result)
+	for _, check := range result.Checks {
+		actions := []string{}
+		for action, count := range check.Actions() {
+			actions = append(actions, fmt.Sprintf("%d %s", count, action))
+		}
+		sort.Strings(actions)
+		c.logger.Infof("%s update took %s: [%s]\n", check.RecordType, check.Duration.Round(time.Millisecond).String(), strings.Join(actions, ", "))
+	}
+	c.history.Observe(result)
+	if err := c.history_db.Observe(result); err != nil {
+		c.logger.Warnf("history could not be recorded in the database: %s\n", err.Error())
+	}
+	c.emitResult(result)
+	c.publishChanges(result)
+	c.writeStatus(result)
+
+	if err != nil {
+		c.count("update.failure")
+		if errors.Is(err, updater.ErrCycleBudgetExhausted) {
+			c.count("update.budget_exhausted")
+		}
+		c.writeMetrics()
+		return
+	}
+	c.count("update.success")
+	c.writeMetrics()
+
+	c.ready.Store(true)
 }
 
 func (c *CloudflareDDNSUpdaterApplication) run() {
-	ctx, cancel := context.WithCancel(context.Background())
-	c.context = ctx
-	c.cancel = cancel
-	for {
-		go c.update(c.context)
-		time.Sleep(c.sleep_interval)
+	if c.health_listen_address != "" {
+		go c.serveHealth(c.context)
 	}
+	if c.health_check_interval > 0 {
+		go c.checkRecords(c.context)
+	}
+	go c.reloadOnHangup()
+	go c.stopOnSignal()
+	c.updater.Run(c.context)
+	c.closeHistoryDB()
+}
+
+// closeHistoryDB closes the history database on shutdown, so the last
+// writes are not lost.
+func (c *CloudflareDDNSUpdaterApplication) closeHistoryDB() {
+	if err := c.history_db.Close(); err != nil {
+		c.logger.Warnf("history database could not be closed: %s\n", err.Error())
+	}
+}
+
+// stopOnSignal stops the updates on SIGINT or SIGTERM, once the queued change
+// events have been published.
+func (c *CloudflareDDNSUpdaterApplication) stopOnSignal() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	select {
+	case <-c.context.Done():
+		return
+	case received := <-stop:
+		c.logger.Infof("received %s, shutting down\n", received.String())
+	}
+	c.flushNotifications(c.notify_timeout)
+	c.cancel()
+}
+
+// runOnce updates the records once and exits, with status 1 if that failed.
+// If nothing had to be written it exits with unchanged_exit_code, so scripts
+// can tell:
+//
+//	0   records were updated (or nothing changed, by default)
+//	1   the update failed
+//	N   nothing changed, with --unchanged-exit-code=N
+func (c *CloudflareDDNSUpdaterApplication) runOnce(print_ip bool, unchanged_exit_code int) {
+	result, err := c.updater.UpdateOnce(c.context)
+	c.onResult(result, err)
+	// the process exits right after, the changes would not be published
+	c.flushNotifications(c.notify_timeout)
+	c.closeHistoryDB()
+	if print_ip {
+		for _, check := range result.Checks {
+			if check.IP != "" {
+				fmt.Println(check.IP)
+			}
+		}
+	}
+	if err != nil {
+		c.logger.Errorf("update failed: %s\n", err.Error())
+		c.exit()
+	}
+	c.cancel()
+	if unchanged_exit_code != 0 && !changed(result) {
+		os.Exit(unchanged_exit_code)
+	}
+}
+
+// changed reports whether an update wrote any record.
+func changed(result updater.Result) bool {
+	for _, check := range result.Checks {
+		for _, record := range check.Records {
+			switch record.Action {
+			case "updated", "created", "reconciled":
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (c *CloudflareDDNSUpdaterApplication) exit() {
@@ -189,10 +820,56 @@ func (c *CloudflareDDNSUpdaterApplication) exit() {
 }
 
 func main() {
+	// hidden on purpose, see serveIP
+	if len(os.Args) > 1 && (os.Args[1] == "--serve-ip" || os.Args[1] == "-serve-ip") {
+		serveIP(os.Args[2:])
+		return
+	}
+
+	report := flag.Bool("report", false, "print whether the managed records are in sync with the current ip and exit")
+	report_json := flag.Bool("json", false, "print the report as json")
+	once := flag.Bool("once", false, "update the records once and exit")
+	print_ip := flag.Bool("print-ip", false, "update once and print only the applied ip to stdout, logging to stderr")
+	unchanged_exit_code := flag.Int("unchanged-exit-code", 0, "exit status of --once and --print-ip if no record had to be changed, e.g. 10")
+	list_records := flag.Bool("list-records", false, "print the A and AAAA records of the zone and exit")
+	test_notify := flag.Bool("test-notify", false, "publish a sample change event to every configured publisher and exit")
+	profile := flag.String("profile", os.Getenv(PROFILE), "profile of the config file to use")
+	config := flag.String("config", "", "config file to use instead of env var CONFIG_FILE, - reads it from stdin")
+	flag.Parse()
+
 	app := new(CloudflareDDNSUpdaterApplication)
-	app.logger = new(cloudflare.LeveledLogger)
-	app.logger.Level = cloudflare.LevelInfo
+	app.context, app.cancel = context.WithCancel(context.Background())
+	app.list_records = *list_records
+	app.stdout_output = *report || *report_json || *print_ip || *list_records || *test_notify
+	if app.stdout_output {
+		// keep stdout clean for the output
+		app.logger = &WriterLeveledLogger{Level: cloudflare.LevelInfo, Writer: os.Stderr}
+	} else {
+		app.logger = &cloudflare.LeveledLogger{Level: cloudflare.LevelInfo}
+	}
+	app.loadConfigFile(*config, *profile)
+	app.configureLogging()
+	app.configureLogFormat()
+	app.configureLogLevel()
+	app.configureEvents()
+	app.configureLogBuffer()
 	app.configure()
+	if *list_records {
+		app.listRecords()
+		return
+	}
+	if *test_notify {
+		app.testNotify()
+		return
+	}
 	app.initialize()
+	if *report || *report_json {
+		app.report(*report_json)
+		return
+	}
+	if *once || *print_ip {
+		app.runOnce(*print_ip, *unchanged_exit_code)
+		return
+	}
 	app.run()
 }
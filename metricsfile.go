@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+// METRICS_FILE is written after every update, e.g. for the textfile collector
+// of node_exporter. A name ending in .json is written as json, anything else
+// in the prometheus text format.
+const METRICS_FILE = "METRICS_FILE"
+
+// MetricsFile keeps the counters and timers also sent to statsd and writes
+// them to a file. All methods are no-ops on a nil *MetricsFile.
+type MetricsFile struct {
+	mutex    sync.Mutex
+	path     string
+	counters map[string]int64
+	timers   map[string]time.Duration
+	// records counts the records of the last update by record type and action
+	records     map[string]map[string]int
+	last_update time.Time
+}
+
+func NewMetricsFile(path string) *MetricsFile {
+	return &MetricsFile{path: path, counters: map[string]int64{}, timers: map[string]time.Duration{}, records: map[string]map[string]int{}}
+}
+
+func (m *MetricsFile) Count(name string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[name]++
+}
+
+func (m *MetricsFile) Timing(name string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.timers[name] = duration
+}
+
+func (m *MetricsFile) Observe(result updater.Result) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.last_update = result.CheckedAt
+	for _, check := range result.Checks {
+		m.records[check.RecordType] = check.Actions()
+	}
+}
+
+// metricName turns a statsd name like "update.failure" into a prometheus one.
+func metricName(name string) string {
+	return "cloudflare_ddns_" + strings.NewReplacer(".", "_", "-", "_").Replace(name)
+}
+
+func (m *MetricsFile) encode() ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if strings.HasSuffix(m.path, ".json") {
+		timers := map[string]float64{}
+		for name, duration := range m.timers {
+			timers[name] = duration.Seconds()
+		}
+		return json.MarshalIndent(map[string]any{
+			"counters":    m.counters,
+			"timers":      timers,
+			"records":     m.records,
+			"last_update": m.last_update,
+		}, "", "  ")
+	}
+
+	lines := []string{}
+	for name, count := range m.counters {
+		lines = append(lines, fmt.Sprintf("# TYPE %s_total counter\n%s_total %d", metricName(name), metricName(name), count))
+	}
+	for name, duration := range m.timers {
+		lines = append(lines, fmt.Sprintf("# TYPE %s_seconds gauge\n%s_seconds %g", metricName(name), metricName(name), duration.Seconds()))
+	}
+	sort.Strings(lines)
+	if !m.last_update.IsZero() {
+		lines = append(lines, fmt.Sprintf("# TYPE cloudflare_ddns_last_update_timestamp_seconds gauge\ncloudflare_ddns_last_update_timestamp_seconds %d", m.last_update.Unix()))
+	}
+	record_lines := []string{}
+	for record_type, actions := range m.records {
+		for action, count := range actions {
+			record_lines = append(record_lines, fmt.Sprintf("cloudflare_ddns_records{record_type=%q,action=%q} %d", record_type, action, count))
+		}
+	}
+	if len(record_lines) > 0 {
+		sort.Strings(record_lines)
+		lines = append(lines, "# TYPE cloudflare_ddns_records gauge\n"+strings.Join(record_lines, "\n"))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// Write atomically replaces the metrics file with the current metrics.
+func (m *MetricsFile) Write() error {
+	if m == nil {
+		return nil
+	}
+	data, err := m.encode()
+	if err != nil {
+		return err
+	}
+	return replaceFile(m.path, data)
+}
+
+// count counts an event in every configured metrics sink.
+func (c *CloudflareDDNSUpdaterApplication) count(name string) {
+	c.statsd.Count(name)
+	c.metrics.Count(name)
+}
+
+// timing records a duration in every configured metrics sink.
+func (c *CloudflareDDNSUpdaterApplication) timing(name string, duration time.Duration) {
+	c.statsd.Timing(name, duration)
+	c.metrics.Timing(name, duration)
+}
+
+// writeMetrics writes the metrics file, if one is configured.
+func (c *CloudflareDDNSUpdaterApplication) writeMetrics() {
+	if err := c.metrics.Write(); err != nil {
+		c.logger.Warnf("metrics file '%s' could not be written: %s\n", c.metrics.path, err.Error())
+	}
+}
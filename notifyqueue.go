@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// NOTIFY_MAX_RETRIES retries publishing a change event this many times,
+	// with a jittered exponential backoff starting at NOTIFY_RETRY_DELAY
+	NOTIFY_MAX_RETRIES = "NOTIFY_MAX_RETRIES"
+	NOTIFY_RETRY_DELAY = "NOTIFY_RETRY_DELAY"
+	// NOTIFY_TIMEOUT bounds all attempts of publishing one change event
+	NOTIFY_TIMEOUT = "NOTIFY_TIMEOUT"
+)
+
+// notify_queue_size is the number of change events waiting per publisher,
+// events beyond it are dropped
+const notify_queue_size = 64
+
+// notification is a change event waiting for a publisher.
+type notification struct {
+	record  string
+	payload []byte
+}
+
+// NotifyQueue publishes the change events of one publisher in the background,
+// so a slow or failing publisher neither blocks the updates nor the other
+// publishers.
+type NotifyQueue struct {
+	// publisher is replaced if its url is reloaded, see reloadPublishers
+	mutex       sync.Mutex
+	publisher   Publisher
+	queue       chan notification
+	max_retries int
+	retry_delay time.Duration
+	timeout     time.Duration
+	// pending counts the queued and the in-flight change events
+	pending sync.WaitGroup
+}
+
+func (c *CloudflareDDNSUpdaterApplication) configureNotifyQueues() {
+	max_retries, retry_delay := c.lookupRetries(NOTIFY_MAX_RETRIES, NOTIFY_RETRY_DELAY)
+	if retry_delay == 0 {
+		retry_delay = time.Second
+	}
+	timeout := 30 * time.Second
+	if parsed, exists := c.lookupDuration(NOTIFY_TIMEOUT); exists {
+		timeout = parsed
+	}
+	if max_retries > 0 {
+		c.logger.Infof("retrying notifications up to %d times within %s\n", max_retries, timeout.String())
+	}
+	c.notify_timeout = timeout
+
+	for _, publisher := range c.publishers {
+		queue := &NotifyQueue{
+			publisher:   publisher,
+			queue:       make(chan notification, notify_queue_size),
+			max_retries: max_retries,
+			retry_delay: retry_delay,
+			timeout:     timeout,
+		}
+		c.notify_queues = append(c.notify_queues, queue)
+		go c.deliverNotifications(queue)
+	}
+}
+
+func (q *NotifyQueue) Publisher() Publisher {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.publisher
+}
+
+func (q *NotifyQueue) SetPublisher(publisher Publisher) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.publisher = publisher
+}
+
+// enqueue queues a change event, dropping it if the queue is full.
+func (c *CloudflareDDNSUpdaterApplication) enqueue(queue *NotifyQueue, item notification) {
+	queue.pending.Add(1)
+	select {
+	case queue.queue <- item:
+	default:
+		queue.pending.Done()
+		c.logger.Warnf("change of '%s' is not published to %s, %d changes are already waiting\n", item.record, queue.Publisher().String(), notify_queue_size)
+		c.events.Emit(Event{Time: time.Now(), Type: "notify", Zone: c.config.ZoneName, Record: item.record, Publisher: queue.Publisher().String(), Error: "queue is full"})
+	}
+}
+
+// deliverNotifications publishes the queued change events until the process
+// exits, flushNotifications waits for them before it does.
+func (c *CloudflareDDNSUpdaterApplication) deliverNotifications(queue *NotifyQueue) {
+	for item := range queue.queue {
+		err := c.deliver(queue, item)
+		notify_event := Event{Time: time.Now(), Type: "notify", Zone: c.config.ZoneName, Record: item.record, Publisher: queue.Publisher().String()}
+		if err != nil {
+			c.logger.Warnf("change of '%s' could not be published to %s: %s\n", item.record, queue.Publisher().String(), err.Error())
+			notify_event.Error = err.Error()
+		}
+		c.events.Emit(notify_event)
+		queue.pending.Done()
+	}
+}
+
+// flushNotifications waits until every queued change event has been
+// published or given up on, but at most timeout. It is called before the
+// process exits, which drops whatever is still queued.
+func (c *CloudflareDDNSUpdaterApplication) flushNotifications(timeout time.Duration) {
+	if len(c.notify_queues) < 1 {
+		return
+	}
+	flushed := make(chan struct{})
+	go func() {
+		for _, queue := range c.notify_queues {
+			queue.pending.Wait()
+		}
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(timeout):
+		c.logger.Warnf("not every change could be published within %s, dropping the rest\n", timeout.String())
+	}
+}
+
+// deliver publishes a change event, retrying with a jittered backoff as long
+// as the retry still starts before the timeout.
+func (c *CloudflareDDNSUpdaterApplication) deliver(queue *NotifyQueue, item notification) error {
+	deadline := time.Now().Add(queue.timeout)
+	delay := queue.retry_delay
+	for attempt := 0; ; attempt++ {
+		err := queue.Publisher().Publish(item.payload)
+		if err == nil || attempt >= queue.max_retries {
+			return err
+		}
+		// between half and one and a half times the delay, so instances
+		// notified of the same change do not retry in lockstep
+		jittered := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		if time.Now().Add(jittered).After(deadline) {
+			return err
+		}
+		c.logger.Debugf("change of '%s' could not be published to %s, retrying in %s: %s\n", item.record, queue.Publisher().String(), jittered.String(), err.Error())
+		select {
+		case <-c.context.Done():
+			return err
+		case <-time.After(jittered):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+const (
+	NATS_URL      = "NATS_URL"
+	NATS_SUBJECT  = "NATS_SUBJECT"
+	REDIS_URL     = "REDIS_URL"
+	REDIS_CHANNEL = "REDIS_CHANNEL"
+	// NOTIFY_TEMPLATE is a text/template rendering the message of a change event
+	NOTIFY_TEMPLATE = "NOTIFY_TEMPLATE"
+)
+
+const default_notify_template = `'{{.Record}}' in zone '{{.Zone}}' {{if .OldIP}}changed from {{.OldIP}} to{{else}}was created with{{end}} {{.NewIP}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}`
+
+// ChangeEvent is published for every updated or created record, Message is
+// rendered from NOTIFY_TEMPLATE with the other fields. OldIP is empty for a
+// created record.
+type ChangeEvent struct {
+	HistoryEntry
+	Zone    string `json:"zone"`
+	Message string `json:"message"`
+}
+
+// Publisher posts change events to a message broker.
+type Publisher interface {
+	Publish(payload []byte) error
+	String() string
+}
+
+// publish_timeout bounds connecting to and talking with a broker
+const publish_timeout = 5 * time.Second
+
+// dialBroker connects to the host of a broker url, with a default port.
+func dialBroker(broker_url *url.URL, default_port string) (net.Conn, *bufio.Reader, error) {
+	address := broker_url.Host
+	if broker_url.Port() == "" {
+		address = net.JoinHostPort(broker_url.Hostname(), default_port)
+	}
+	conn, err := net.DialTimeout("tcp", address, publish_timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(publish_timeout))
+	return conn, bufio.NewReader(conn), nil
+}
+
+// NATSPublisher publishes to a NATS subject, speaking the plain text protocol
+// over a connection per event since changes are rare.
+type NATSPublisher struct {
+	url     *url.URL
+	subject string
+}
+
+func (p *NATSPublisher) String() string {
+	return "nats subject '" + p.subject + "'"
+}
+
+func (p *NATSPublisher) Publish(payload []byte) error {
+	conn, reader, err := dialBroker(p.url, "4222")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the server greets with its INFO
+	if _, err := reader.ReadString('\n'); err != nil {
+		return err
+	}
+	connect := map[string]interface{}{"verbose": false, "pedantic": false}
+	if p.url.User != nil {
+		if password, exists := p.url.User.Password(); exists {
+			connect["user"], connect["pass"] = p.url.User.Username(), password
+		} else {
+			connect["auth_token"] = p.url.User.Username()
+		}
+	}
+	connect_bytes, _ := json.Marshal(connect)
+	fmt.Fprintf(conn, "CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", connect_bytes, p.subject, len(payload), payload)
+
+	// PONG confirms the publish was processed, errors arrive as -ERR before it
+	reply, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "PONG") {
+		return fmt.Errorf("nats replied '%s'", strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+// RedisPublisher publishes to a Redis pub/sub channel.
+type RedisPublisher struct {
+	url     *url.URL
+	channel string
+}
+
+func (p *RedisPublisher) String() string {
+	return "redis channel '" + p.channel + "'"
+}
+
+func redisCommand(arguments ...string) string {
+	command := "*" + strconv.Itoa(len(arguments)) + "\r\n"
+	for _, argument := range arguments {
+		command += "$" + strconv.Itoa(len(argument)) + "\r\n" + argument + "\r\n"
+	}
+	return command
+}
+
+func (p *RedisPublisher) Publish(payload []byte) error {
+	conn, reader, err := dialBroker(p.url, "6379")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	commands := []string{}
+	if p.url.User != nil {
+		if password, exists := p.url.User.Password(); exists {
+			commands = append(commands, redisCommand("AUTH", p.url.User.Username(), password))
+		} else {
+			commands = append(commands, redisCommand("AUTH", p.url.User.Username()))
+		}
+	}
+	commands = append(commands, redisCommand("PUBLISH", p.channel, string(payload)))
+
+	for _, command := range commands {
+		if _, err := conn.Write([]byte(command)); err != nil {
+			return err
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(reply, "-") {
+			return fmt.Errorf("redis replied '%s'", strings.TrimSpace(reply))
+		}
+	}
+	return nil
+}
+
+func (c *CloudflareDDNSUpdaterApplication) configurePublishers() {
+	notify_template, exists := c.lookupEnv(NOTIFY_TEMPLATE)
+	if !exists {
+		notify_template = default_notify_template
+	}
+	parsed, err := template.New(NOTIFY_TEMPLATE).Option("missingkey=error").Parse(notify_template)
+	if err != nil {
+		c.logger.Errorf("notify template '%s' could not be parsed: %s\n", notify_template, err.Error())
+		c.exit()
+	}
+	c.notify_template = parsed
+
+	for _, broker := range brokers {
+		broker_url_string, exists := c.lookupEnv(broker.url_name)
+		if !exists {
+			continue
+		}
+		publisher, err := c.newPublisher(broker, broker_url_string)
+		if err != nil {
+			c.logger.Errorf("%s\n", err.Error())
+			c.exit()
+		}
+		c.publishers = append(c.publishers, publisher)
+		c.publisher_sources = append(c.publisher_sources, publisherSource{broker: broker, url: broker_url_string})
+	}
+	c.configureNotifyQueues()
+}
+
+// broker is a kind of message broker, configured by the url in env var
+// url_name and the subject or channel in target_name.
+type broker struct {
+	url_name, target_name, scheme string
+	new                           func(*url.URL, string) Publisher
+}
+
+var brokers = []broker{
+	{NATS_URL, NATS_SUBJECT, "nats", func(u *url.URL, subject string) Publisher { return &NATSPublisher{u, subject} }},
+	{REDIS_URL, REDIS_CHANNEL, "redis", func(u *url.URL, channel string) Publisher { return &RedisPublisher{u, channel} }},
+}
+
+// publisherSource is what a publisher was created from, to tell whether a
+// reloaded url changed it.
+type publisherSource struct {
+	broker broker
+	url    string
+}
+
+// newPublisher creates the publisher of a broker url.
+func (c *CloudflareDDNSUpdaterApplication) newPublisher(broker broker, broker_url_string string) (Publisher, error) {
+	broker_url, err := url.Parse(broker_url_string)
+	if err != nil || broker_url.Scheme != broker.scheme || broker_url.Hostname() == "" {
+		return nil, fmt.Errorf("value of env var '%s' is not a %s://host[:port] url", broker.url_name, broker.scheme)
+	}
+	target, exists := c.lookupEnv(broker.target_name)
+	if !exists {
+		target = "cloudflare-ddns.changes"
+	}
+	publisher := broker.new(broker_url, target)
+	c.logger.Infof("publishing ip changes to %s on '%s'\n", publisher.String(), broker_url.Host)
+	return publisher, nil
+}
+
+// publishChanges queues an event per changed record for every publisher, a
+// broker that can not be reached only costs a warning.
+func (c *CloudflareDDNSUpdaterApplication) publishChanges(result updater.Result) {
+	if len(c.notify_queues) < 1 {
+		return
+	}
+	for _, check := range result.Checks {
+		for _, record := range check.Records {
+			if record.Action != "updated" && record.Action != "created" {
+				continue
+			}
+			event := ChangeEvent{
+				HistoryEntry: HistoryEntry{Time: result.CheckedAt, Record: record.Name, OldIP: record.PreviousContent, NewIP: record.Content},
+				Zone:         c.config.ZoneName,
+			}
+			payload, err := c.renderEvent(event)
+			if err != nil {
+				c.logger.Warnf("change of '%s' could not be published: %s\n", record.Name, err.Error())
+				continue
+			}
+			for _, queue := range c.notify_queues {
+				c.enqueue(queue, notification{record: record.Name, payload: payload})
+			}
+		}
+	}
+}
+
+// renderEvent renders the message of an event and encodes it as the payload
+// for the publishers.
+func (c *CloudflareDDNSUpdaterApplication) renderEvent(event ChangeEvent) ([]byte, error) {
+	message := strings.Builder{}
+	if err := c.notify_template.Execute(&message, event); err != nil {
+		c.logger.Warnf("notify template could not be rendered for '%s': %s\n", event.Record, err.Error())
+	}
+	event.Message = message.String()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("change event could not be encoded: %w", err)
+	}
+	return payload, nil
+}
+
+// testNotify publishes a sample change event to every publisher the way a
+// change is, with the retries and the timeout of its queue, reports which
+// ones failed and exits, with status 1 if any did.
+func (c *CloudflareDDNSUpdaterApplication) testNotify() {
+	if len(c.publishers) < 1 {
+		c.logger.Errorf("no publishers are configured, set '%s' or '%s'\n", NATS_URL, REDIS_URL)
+		c.exit()
+	}
+	record := c.config.RecordName
+	if record == "" {
+		record = "test." + c.config.ZoneName
+	}
+	event := ChangeEvent{
+		HistoryEntry: HistoryEntry{Time: time.Now(), Record: record, OldIP: "192.0.2.1", NewIP: "192.0.2.2"},
+		Zone:         c.config.ZoneName,
+	}
+
+	payload, err := c.renderEvent(event)
+	if err != nil {
+		c.logger.Errorf("%s\n", err.Error())
+		c.exit()
+	}
+
+	failed := 0
+	for _, queue := range c.notify_queues {
+		if err := c.deliver(queue, notification{record: record, payload: payload}); err != nil {
+			failed++
+			fmt.Printf("FAILED  %s: %s\n", queue.Publisher().String(), err.Error())
+			continue
+		}
+		fmt.Printf("OK      %s\n", queue.Publisher().String())
+	}
+	if failed > 0 {
+		c.exit()
+	}
+	c.cancel()
+}
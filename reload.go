@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadOnHangup re-reads the secrets that are read from files on SIGHUP, the
+// api token of CLOUDFLARE_API_TOKEN_FILE, the broker urls of NATS_URL_FILE and
+// REDIS_URL_FILE and the /logs token of HEALTH_LOGS_TOKEN_FILE, so a rotated
+// secret is picked up without a restart.
+func (c *CloudflareDDNSUpdaterApplication) reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-c.context.Done():
+			return
+		case <-hangup:
+			c.reloadAPIToken()
+			c.reloadPublishers()
+			c.reloadLogsToken()
+		}
+	}
+}
+
+// reloadAPIToken replaces the api client if the token file holds a new token
+// that cloudflare accepts, otherwise the current client is kept.
+func (c *CloudflareDDNSUpdaterApplication) reloadAPIToken() {
+	path, exists := c.secretFile(API_TOKEN_ENV_VARIABLE_NAME)
+	if !exists {
+		c.logger.Warnf("received SIGHUP, but the api token is not read from a file, use '%s' to rotate it\n", API_TOKEN_ENV_VARIABLE_NAME+"_FILE")
+		return
+	}
+
+	token, err := readSecretFile(path)
+	if err != nil {
+		c.logger.Errorf("received SIGHUP, but file '%s' could not be read, keeping the current api token: %s\n", path, err.Error())
+		return
+	}
+	if token == c.config.APIToken {
+		c.logger.Infof("received SIGHUP, the api token in '%s' did not change\n", path)
+		return
+	}
+
+	c.log_buffer.Redact(token)
+	if err := c.updater.SetAPIToken(c.context, token); err != nil {
+		c.logger.Errorf("received SIGHUP, but the new api token in '%s' is not usable, keeping the current one: %s\n", path, err.Error())
+		return
+	}
+	c.config.APIToken = token
+	c.logger.Infof("received SIGHUP, the api token was reloaded from '%s'\n", path)
+}
+
+// reloadPublishers replaces the publishers whose url file holds a new url,
+// a url that is not valid keeps the current publisher.
+func (c *CloudflareDDNSUpdaterApplication) reloadPublishers() {
+	for index, source := range c.publisher_sources {
+		path, exists := c.secretFile(source.broker.url_name)
+		if !exists {
+			continue
+		}
+		broker_url, err := readSecretFile(path)
+		if err != nil {
+			c.logger.Errorf("received SIGHUP, but file '%s' could not be read, keeping the current %s: %s\n", path, c.publishers[index].String(), err.Error())
+			continue
+		}
+		if broker_url == source.url {
+			continue
+		}
+		publisher, err := c.newPublisher(source.broker, broker_url)
+		if err != nil {
+			c.logger.Errorf("received SIGHUP, but the new url in '%s' is not usable, keeping the current one: %s\n", path, err.Error())
+			continue
+		}
+		c.publishers[index] = publisher
+		c.publisher_sources[index].url = broker_url
+		c.notify_queues[index].SetPublisher(publisher)
+		c.logger.Infof("received SIGHUP, the url of %s was reloaded from '%s'\n", publisher.String(), path)
+	}
+}
+
+// reloadLogsToken replaces the token of /logs if its file holds a new one.
+func (c *CloudflareDDNSUpdaterApplication) reloadLogsToken() {
+	if c.log_buffer == nil {
+		return
+	}
+	path, exists := c.secretFile(HEALTH_LOGS_TOKEN)
+	if !exists {
+		return
+	}
+	logs_token, err := readSecretFile(path)
+	if err != nil {
+		c.logger.Errorf("received SIGHUP, but file '%s' could not be read, keeping the current /logs token: %s\n", path, err.Error())
+		return
+	}
+	if current, _ := c.logs_token.Load().(string); logs_token == current {
+		return
+	}
+	if logs_token == "" {
+		c.logger.Errorf("received SIGHUP, but file '%s' is empty, keeping the current /logs token\n", path)
+		return
+	}
+	c.log_buffer.Redact(logs_token)
+	c.logs_token.Store(logs_token)
+	c.logger.Infof("received SIGHUP, the /logs token was reloaded from '%s'\n", path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+// report prints a reconciliation report of the managed records and exits, with
+// status 1 if any record has drifted or could not be checked.
+func (c *CloudflareDDNSUpdaterApplication) report(as_json bool) {
+	report, err := c.updater.Reconcile(c.context)
+	if err != nil {
+		c.logger.Errorf("records could not be reconciled: %s\n", err.Error())
+		c.exit()
+	}
+
+	if as_json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			c.logger.Errorf("report could not be written: %s\n", err.Error())
+			c.exit()
+		}
+	} else {
+		fmt.Printf("reconciliation report of zone '%s' @ %s\n", c.config.ZoneName, report.CheckedAt.String())
+		fmt.Println(strings.Repeat("-", 50))
+		for _, entry := range report.Entries {
+			state := "in sync"
+			if !entry.InSync {
+				state = "DRIFT"
+			}
+			live := entry.Live
+			if live == "" {
+				live = "(missing)"
+			}
+			fmt.Printf("%-7s %-5s %s live: %s desired: %s\n", state, entry.Type, entry.Name, live, entry.Desired)
+		}
+		for _, report_error := range report.Errors {
+			fmt.Printf("ERROR   %s\n", report_error)
+		}
+	}
+
+	if !report.InSync() {
+		c.exit()
+	}
+	c.cancel()
+}
+
+// listRecords prints the A and AAAA records of the zone with the ids and
+// settings to plug into the config, and exits.
+func (c *CloudflareDDNSUpdaterApplication) listRecords() {
+	records, err := updater.ListRecords(c.context, c.config)
+	if err != nil {
+		c.logger.Errorf("records could not be listed: %s\n", err.Error())
+		c.exit()
+	}
+
+	fmt.Printf("%-32s  %-4s  %-6s  %-7s  %-39s  %s\n", "ID", "TYPE", "TTL", "PROXIED", "CONTENT", "NAME")
+	for _, record := range records {
+		ttl := strconv.Itoa(record.TTL)
+		if record.TTL == 1 {
+			ttl = "auto"
+		}
+		proxied := record.Proxied != nil && *record.Proxied
+		fmt.Printf("%-32s  %-4s  %-6s  %-7t  %-39s  %s\n", record.ID, record.Type, ttl, proxied, record.Content, record.Name)
+	}
+	c.cancel()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// serveIP is the hidden --serve-ip mode, a tiny ip info endpoint answering
+// every request with a fixed ip, for integration tests and offline demos. It
+// is not meant for production use.
+func serveIP(args []string) {
+	logger := &cloudflare.LeveledLogger{Level: cloudflare.LevelInfo}
+
+	flags := flag.NewFlagSet("serve-ip", flag.ExitOnError)
+	listen_address := flags.String("listen", ":8080", "address to listen on")
+	ip_string := flags.String("ip", "203.0.113.1", "ip to answer with")
+	flags.Parse(args)
+
+	ip := net.ParseIP(*ip_string)
+	if ip == nil {
+		logger.Errorf("'%s' is not an ip address\n", *ip_string)
+		os.Exit(1)
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(ip.String() + "\n"))
+	})
+
+	logger.Warnf("serving the fixed ip %s on '%s', this is for testing only\n", ip.String(), *listen_address)
+	if err := http.ListenAndServe(*listen_address, nil); err != nil {
+		logger.Errorf("ip info endpoint could not be served: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// StatsD emits counters and timers over udp. Sending never blocks the caller
+// and errors are ignored, metrics are best effort. All methods are no-ops on
+// a nil *StatsD, so callers don't need to check whether statsd is configured.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+}
+
+func NewStatsD(address string, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: prefix}, nil
+}
+
+func (s *StatsD) send(name string, value string, kind string) {
+	if s == nil {
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	fmt.Fprintf(s.conn, "%s%s:%s|%s", s.prefix, name, value, kind)
+}
+
+func (s *StatsD) Count(name string) {
+	s.send(name, "1", "c")
+}
+
+func (s *StatsD) Timing(name string, duration time.Duration) {
+	s.send(name, fmt.Sprint(duration.Milliseconds()), "ms")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+// StatusSnapshot is the status file entry for one record type.
+type StatusSnapshot struct {
+	LastCheck time.Time              `json:"last_check"`
+	CurrentIP string                 `json:"current_ip,omitempty"`
+	Records   []updater.RecordResult `json:"records"`
+	LastError string                 `json:"last_error,omitempty"`
+	// Zone and ZoneID are the zone of the records, a fallback for looking it
+	// up by its name
+	Zone   string `json:"zone,omitempty"`
+	ZoneID string `json:"zone_id,omitempty"`
+}
+
+// readStatusZoneID reads the id of the configured zone in the previous run
+// from the status file, empty if there is none.
+func (c *CloudflareDDNSUpdaterApplication) readStatusZoneID() string {
+	status_bytes, err := os.ReadFile(c.status_file)
+	if err != nil {
+		return ""
+	}
+	status := map[string]StatusSnapshot{}
+	if err := json.Unmarshal(status_bytes, &status); err != nil {
+		c.logger.Warnf("status file '%s' could not be decoded, not using its zone id: %s\n", c.status_file, err.Error())
+		return ""
+	}
+	for _, snapshot := range status {
+		if snapshot.ZoneID != "" && snapshot.Zone == c.config.ZoneName {
+			return snapshot.ZoneID
+		}
+	}
+	return ""
+}
+
+// writeStatus atomically replaces the status file with the latest result of
+// every record type, so readers never see a partially written file.
+func (c *CloudflareDDNSUpdaterApplication) writeStatus(result updater.Result) {
+	if c.status_file == "" {
+		return
+	}
+
+	c.status_mutex.Lock()
+	defer c.status_mutex.Unlock()
+
+	for _, check := range result.Checks {
+		snapshot := StatusSnapshot{
+			LastCheck: result.CheckedAt,
+			CurrentIP: check.IP,
+			Records:   check.Records,
+			Zone:      c.config.ZoneName,
+			ZoneID:    c.updater.ZoneID(),
+		}
+		if check.Err != nil {
+			snapshot.LastError = check.Err.Error()
+		}
+		c.status[check.RecordType] = snapshot
+	}
+
+	status_bytes, err := json.MarshalIndent(c.status, "", "  ")
+	if err != nil {
+		c.logger.Warnf("status could not be encoded: %s\n", err.Error())
+		return
+	}
+
+	if err := replaceFile(c.status_file, append(status_bytes, '\n')); err != nil {
+		c.logger.Warnf("status file '%s' could not be written: %s\n", c.status_file, err.Error())
+	}
+}
+
+// replaceFile atomically replaces the file at path with data, so readers never
+// see a partially written file.
+func replaceFile(path string, data []byte) error {
+	temp_file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp_file.Name())
+
+	if _, err := temp_file.Write(data); err != nil {
+		temp_file.Close()
+		return err
+	}
+	// CreateTemp creates the file as 0600, the files are meant to be read by other tools
+	if err := temp_file.Chmod(0644); err != nil {
+		temp_file.Close()
+		return err
+	}
+	if err := temp_file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp_file.Name(), path)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"beemo.at/cloudflare-ddns/updater"
+)
+
+// ConfigSummary is the effective configuration logged at startup, with the
+// secrets redacted.
+type ConfigSummary struct {
+	Zone           string            `json:"zone"`
+	Records        []string          `json:"records"`
+	Mirrors        []string          `json:"mirrors,omitempty"`
+	Families       []string          `json:"families"`
+	Interval       string            `json:"interval"`
+	Intervals      map[string]string `json:"intervals,omitempty"`
+	IPSource       string            `json:"ip_source"`
+	Endpoints      []string          `json:"endpoints,omitempty"`
+	LookupStrategy string            `json:"lookup_strategy"`
+	Modes          []string          `json:"modes"`
+	APIToken       string            `json:"api_token"`
+}
+
+// redactURL hides the password and the query of an endpoint url, both may
+// carry a secret.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "[unparsable url]"
+	}
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = "redacted"
+	}
+	return parsed.Redacted()
+}
+
+func (c *CloudflareDDNSUpdaterApplication) configSummary() ConfigSummary {
+	summary := ConfigSummary{
+		Zone:           c.config.ZoneName,
+		Families:       []string{},
+		Interval:       (5 * time.Minute).String(),
+		LookupStrategy: c.config.LookupStrategy,
+		Modes:          []string{},
+		APIToken:       "[redacted]",
+	}
+	if c.config.ZoneID != "" {
+		summary.Zone = c.config.ZoneID
+	}
+
+	switch {
+	case c.config.RecordID != "":
+		summary.Records = []string{"id:" + c.config.RecordID}
+	case c.config.RecordComment != "":
+		summary.Records = []string{"comment:" + c.config.RecordComment}
+	default:
+		summary.Records = []string{c.config.RecordName}
+	}
+	summary.Records = append(summary.Records, c.config.RecordAliases...)
+	for _, mirror := range c.config.Mirrors {
+		summary.Mirrors = append(summary.Mirrors, mirror.String())
+	}
+
+	// like New defaults them
+	families := c.config.Families
+	if c.config.RecordType != "" {
+		families = []string{map[string]string{"A": "4", "AAAA": "6"}[c.config.RecordType]}
+	} else if len(families) < 1 {
+		families = []string{""}
+	}
+	for _, family := range families {
+		if family == "" {
+			family = "any"
+		}
+		summary.Families = append(summary.Families, family)
+	}
+	if c.config.Interval > 0 {
+		summary.Interval = c.config.Interval.String()
+	}
+	if len(c.config.Intervals) > 0 {
+		summary.Intervals = map[string]string{}
+		for family, interval := range c.config.Intervals {
+			summary.Intervals[family] = interval.String()
+		}
+	}
+	if summary.LookupStrategy == "" {
+		summary.LookupStrategy = "list"
+		if c.config.RecordID != "" {
+			summary.LookupStrategy = "id"
+		}
+	}
+
+	switch {
+	case c.config.CNAMETarget != "":
+		summary.IPSource = "none, CNAME to '" + c.config.CNAMETarget + "'"
+	case c.config.ResolveHostname != "":
+		summary.IPSource = "resolve '" + c.config.ResolveHostname + "'"
+	case c.config.Interface != "":
+		summary.IPSource = "interface '" + c.config.Interface + "'"
+	case c.config.CurrentIP != nil:
+		summary.IPSource = "env"
+	default:
+		summary.IPSource = "endpoint"
+		for _, endpoint := range c.config.Endpoints {
+			description := redactURL(endpoint.URL)
+			if endpoint.Family != "" {
+				description = endpoint.Family + "=" + description
+			}
+			if endpoint.Priority != 0 {
+				description += fmt.Sprintf(" priority=%d", endpoint.Priority)
+			}
+			if endpoint.Verify {
+				description += " verify"
+			}
+			summary.Endpoints = append(summary.Endpoints, description)
+		}
+	}
+
+	modes := []struct {
+		name    string
+		enabled bool
+	}{
+		{"restore-only", c.config.RestoreOnly},
+		{"create-missing-a", c.config.CreateMissing["A"]},
+		{"create-missing-aaaa", c.config.CreateMissing["AAAA"]},
+		{"www-cname", c.config.WWWCNAME},
+		{"proxied", c.config.ExpectProxied},
+		{"reconcile-settings", c.config.ReconcileSettings},
+		{"reconcile-on-start", c.config.ReconcileOnStart},
+		{"adaptive-ttl", c.config.AdaptiveTTL},
+		{"respect-ttl", c.config.RespectTTL},
+		{"batch-lookup", c.config.BatchLookup},
+		{"detect-noop", c.config.DetectNoop},
+		{"skip-cgnat", c.config.SkipCGNAT},
+		{"skip-blocked", c.config.SkipBlocked},
+		{"skip-family-mismatch", c.config.SkipFamilyMismatch},
+		{"strict-tls", c.config.StrictTLS},
+		{"update-window", c.config.UpdateWindow != nil},
+		{"ha-lock", c.config.HALock != ""},
+		{"debug", c.debug},
+	}
+	for _, mode := range modes {
+		if mode.enabled {
+			summary.Modes = append(summary.Modes, mode.name)
+		}
+	}
+	return summary
+}
+
+// logConfigSummary logs the effective configuration in a single line, with
+// LOG_FORMAT=json as the config field of the json line.
+func (c *CloudflareDDNSUpdaterApplication) logConfigSummary() {
+	summary := c.configSummary()
+	if logger, ok := c.logger.(updater.FieldLogger); ok && c.log_format == "json" {
+		logger.InfoWith("effective configuration", map[string]any{"config": summary})
+		return
+	}
+
+	parts := []string{
+		fmt.Sprintf("zone '%s'", summary.Zone),
+		fmt.Sprintf("records [%s]", strings.Join(summary.Records, ", ")),
+		fmt.Sprintf("families [%s]", strings.Join(summary.Families, ", ")),
+		fmt.Sprintf("interval %s", summary.Interval),
+		fmt.Sprintf("ip source %s", summary.IPSource),
+		fmt.Sprintf("lookup %s", summary.LookupStrategy),
+	}
+	if len(summary.Mirrors) > 0 {
+		parts = append(parts, fmt.Sprintf("mirrors [%s]", strings.Join(summary.Mirrors, ", ")))
+	}
+	if len(summary.Intervals) > 0 {
+		parts = append(parts, fmt.Sprintf("intervals %v", summary.Intervals))
+	}
+	if len(summary.Endpoints) > 0 {
+		parts = append(parts, fmt.Sprintf("endpoints [%s]", strings.Join(summary.Endpoints, ", ")))
+	}
+	parts = append(parts, fmt.Sprintf("modes [%s]", strings.Join(summary.Modes, ", ")))
+	c.logger.Infof("effective configuration: %s\n", strings.Join(parts, ", "))
+}
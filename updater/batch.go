@@ -0,0 +1,69 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// batch_max_records is the size of a zone up to which BatchLookup lists all of
+// its records, larger zones are looked up record by record
+const batch_max_records = 1000
+
+// batch_page_size is the page size of a batch lookup
+const batch_page_size = 100
+
+// recordLookup returns the records of a type and name.
+type recordLookup func(name string) ([]cloudflare.DNSRecord, error)
+
+// lookupRecords returns the lookup of managedRecords, one list call per name
+// or, with BatchLookup, one list of the whole zone matched in memory.
+func (u *Updater) lookupRecords(ctx context.Context, rc *cloudflare.ResourceContainer, record_type string) (recordLookup, error) {
+	lookup := func(name string) ([]cloudflare.DNSRecord, error) {
+		records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Type: record_type, Name: name})
+		u.breaker.Record(err)
+		return records, err
+	}
+	// a single name is looked up with a single call anyway
+	if !u.config.BatchLookup || len(u.config.RecordAliases) < 1 {
+		return lookup, nil
+	}
+	for _, name := range append([]string{u.config.RecordName}, u.config.RecordAliases...) {
+		// the api returns names in their ascii form, which is not worth
+		// converting to for an optimization
+		if strings.ContainsFunc(name, func(r rune) bool { return r > 127 }) {
+			return lookup, nil
+		}
+	}
+
+	params := cloudflare.ListDNSRecordsParams{Type: record_type, ResultInfo: cloudflare.ResultInfo{Page: 1, PerPage: batch_page_size}}
+	records, info, err := u.client().ListDNSRecords(ctx, rc, params)
+	u.breaker.Record(err)
+	if err != nil {
+		return nil, fmt.Errorf("could not list the %s records of zone '%s': %w", record_type, u.config.ZoneName, err)
+	}
+	if info.Total > batch_max_records {
+		u.logger.Infof("zone '%s' has %d %s records, too many to list at once, looking them up one by one\n", u.config.ZoneName, info.Total, record_type)
+		return lookup, nil
+	}
+	for page := 2; page <= info.TotalPages; page++ {
+		params.ResultInfo.Page = page
+		page_records, _, err := u.client().ListDNSRecords(ctx, rc, params)
+		u.breaker.Record(err)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the %s records of zone '%s': %w", record_type, u.config.ZoneName, err)
+		}
+		records = append(records, page_records...)
+	}
+
+	by_name := map[string][]cloudflare.DNSRecord{}
+	for _, record := range records {
+		name := strings.ToLower(strings.TrimSuffix(record.Name, "."))
+		by_name[name] = append(by_name[name], record)
+	}
+	return func(name string) ([]cloudflare.DNSRecord, error) {
+		return by_name[strings.ToLower(strings.TrimSuffix(name, "."))], nil
+	}, nil
+}
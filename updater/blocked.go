@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// ErrZonePaused is wrapped by the error of an update that failed while the
+// zone is paused.
+var ErrZonePaused = errors.New("zone is paused")
+
+// ErrRecordLocked is wrapped by the error of an update of a record cloudflare
+// does not allow to edit, e.g. one managed by another cloudflare product.
+var ErrRecordLocked = errors.New("record is locked")
+
+// blocked returns the distinct error of an update that can not succeed
+// however often it is retried, nil if the update is not blocked.
+func (u *Updater) blocked(record cloudflare.DNSRecord, err error) error {
+	if record.Locked {
+		return fmt.Errorf("%w, cloudflare does not allow editing '%s'", ErrRecordLocked, record.Name)
+	}
+	if err != nil && u.zone_paused.Load() {
+		return fmt.Errorf("%w, could not update record '%s' in zone '%s': %w", ErrZonePaused, record.Name, u.config.ZoneName, err)
+	}
+	return nil
+}
+
+// skipBlocked records a blocked update as skipped if Config.SkipBlocked is
+// set, otherwise as failed with its error.
+func (u *Updater) skipBlocked(record cloudflare.DNSRecord, err error, check *Check) error {
+	if u.config.SkipBlocked {
+		u.logger.Warnf("%s, skipping the record\n", err.Error())
+		check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "skipped", Content: record.Content})
+		return nil
+	}
+	check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "failed", Content: record.Content})
+	return err
+}
@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+var ErrCircuitOpen = errors.New("cloudflare api circuit breaker is open")
+
+// CircuitBreaker stops calling the cloudflare api for a cooldown after it
+// failed threshold times in a row. After the cooldown a single trial call is
+// let through (half-open), closing the circuit again if it succeeds. All
+// methods are no-ops on a nil *CircuitBreaker.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	on_change func(state string)
+	// clock is replaced by the Updater with its own
+	clock Clock
+
+	mutex     sync.Mutex
+	state     string
+	failures  int
+	opened_at time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration, on_change func(state string)) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, on_change: on_change, clock: RealClock{}, state: CircuitClosed}
+}
+
+func (b *CircuitBreaker) transition(state string) {
+	b.state = state
+	if b.on_change != nil {
+		b.on_change(state)
+	}
+}
+
+// Allow returns ErrCircuitOpen while api calls are short-circuited.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		remaining := b.cooldown - b.clock.Now().Sub(b.opened_at)
+		if remaining > 0 {
+			return fmt.Errorf("%w, retrying in %s", ErrCircuitOpen, remaining.Round(time.Second).String())
+		}
+		b.transition(CircuitHalfOpen)
+		return nil
+	case CircuitHalfOpen:
+		// a trial call is already in flight
+		return fmt.Errorf("%w, a trial call is in progress", ErrCircuitOpen)
+	default:
+		return nil
+	}
+}
+
+// isOutage reports whether an error means the api itself is unavailable,
+// as opposed to rejecting a request it was able to handle.
+func isOutage(err error) bool {
+	var service_error *cloudflare.ServiceError
+	var ratelimit_error *cloudflare.RatelimitError
+	if errors.As(err, &service_error) || errors.As(err, &ratelimit_error) {
+		return true
+	}
+	var authorization_error *cloudflare.AuthorizationError
+	var authentication_error *cloudflare.AuthenticationError
+	var not_found_error *cloudflare.NotFoundError
+	var request_error *cloudflare.RequestError
+	if errors.As(err, &authorization_error) || errors.As(err, &authentication_error) || errors.As(err, &not_found_error) || errors.As(err, &request_error) {
+		return false
+	}
+	// anything else did not even get a response, e.g. network errors
+	return true
+}
+
+// Record records the outcome of an api call.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil || !isOutage(err) {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.transition(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.opened_at = b.clock.Now()
+		if b.state != CircuitOpen {
+			b.transition(CircuitOpen)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package updater
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of an Updater, so intervals, retries and the
+// circuit breaker can be tested with a FakeClock instead of real sleeps.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for the duration or until the context is done.
+	Sleep(ctx context.Context, duration time.Duration) error
+	NewTicker(duration time.Duration) Ticker
+}
+
+// Ticker is the part of a time.Ticker used by the Updater.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the Clock of the time package.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) Sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (RealClock) NewTicker(duration time.Duration) Ticker {
+	return realTicker{time.NewTicker(duration)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock only moves when Advance is called, firing the sleeps and tickers
+// that are due by then.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	at      time.Time
+	period  time.Duration
+	channel chan time.Time
+	stopped bool
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) wait(duration time.Duration, period time.Duration) *fakeWaiter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	waiter := &fakeWaiter{at: c.now.Add(duration), period: period, channel: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, waiter)
+	return waiter
+}
+
+func (c *FakeClock) Sleep(ctx context.Context, duration time.Duration) error {
+	waiter := c.wait(duration, 0)
+	select {
+	case <-ctx.Done():
+		c.mutex.Lock()
+		waiter.stopped = true
+		c.mutex.Unlock()
+		return ctx.Err()
+	case <-waiter.channel:
+		return nil
+	}
+}
+
+func (c *FakeClock) NewTicker(duration time.Duration) Ticker {
+	return &fakeTicker{clock: c, waiter: c.wait(duration, duration)}
+}
+
+// Advance moves the clock forward, like a time.Ticker a ticker whose receiver
+// falls behind drops ticks.
+func (c *FakeClock) Advance(duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(duration)
+
+	pending := []*fakeWaiter{}
+	for _, waiter := range c.waiters {
+		if waiter.stopped {
+			continue
+		}
+		for !waiter.at.After(c.now) {
+			select {
+			case waiter.channel <- waiter.at:
+			default:
+			}
+			if waiter.period <= 0 {
+				waiter.stopped = true
+				break
+			}
+			waiter.at = waiter.at.Add(waiter.period)
+		}
+		if !waiter.stopped {
+			pending = append(pending, waiter)
+		}
+	}
+	c.waiters = pending
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.channel
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.waiter.stopped = true
+}
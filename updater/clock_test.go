@@ -0,0 +1,83 @@
+package updater
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	slept := make(chan error, 1)
+	go func() { slept <- clock.Sleep(context.Background(), time.Minute) }()
+
+	// the sleep may not have started yet, advancing in steps fires it either way
+	clock.Advance(30 * time.Second)
+	select {
+	case <-slept:
+		t.Fatalf("sleep of a minute returned after 30s")
+	case <-time.After(10 * time.Millisecond):
+	}
+	for i := 0; ; i++ {
+		clock.Advance(30 * time.Second)
+		select {
+		case err := <-slept:
+			if err != nil {
+				t.Fatalf("Sleep() failed: %s", err.Error())
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		if i > 10 {
+			t.Fatalf("sleep of a minute did not return")
+		}
+	}
+}
+
+func TestRunWithFakeClock(t *testing.T) {
+	_, server := newFakeAPI(t, cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.7", TTL: 1})
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	results := make(chan Result, 10)
+	u := newTestUpdater(t, server, Config{
+		RecordName: "home",
+		Interval:   5 * time.Minute,
+		Clock:      clock,
+		OnResult:   func(result Result, err error) { results <- result },
+	}, "198.51.100.7")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- u.Run(ctx) }()
+
+	expect := func(update bool, when string) {
+		t.Helper()
+		select {
+		case result := <-results:
+			if !update {
+				t.Fatalf("updated %s", when)
+			}
+			if !result.CheckedAt.Equal(clock.Now()) {
+				t.Errorf("update %s checked at %s, want %s", when, result.CheckedAt.String(), clock.Now().String())
+			}
+		case <-time.After(100 * time.Millisecond):
+			if update {
+				t.Fatalf("not updated %s", when)
+			}
+		}
+	}
+	// the ticker exists once the first update ran
+	expect(true, "at the start")
+	clock.Advance(4 * time.Minute)
+	expect(false, "before the interval passed")
+	clock.Advance(time.Minute)
+	expect(true, "after the interval")
+	clock.Advance(5 * time.Minute)
+	expect(true, "after the second interval")
+
+	cancel()
+	if err := <-stopped; err != context.Canceled {
+		t.Errorf("Run() returned %v, want %v", err, context.Canceled)
+	}
+}
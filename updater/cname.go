@@ -0,0 +1,90 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// ensureCNAME makes sure the CNAME record name points at target, creating it if
+// it does not exist yet and create is set.
+func (u *Updater) ensureCNAME(ctx context.Context, rc *cloudflare.ResourceContainer, name string, target string, create bool) (RecordResult, error) {
+	records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+		Type: "CNAME",
+		Name: name,
+	})
+	u.breaker.Record(err)
+	if err != nil {
+		return RecordResult{Name: name, Action: "failed"}, fmt.Errorf("could not list records for '%s': %w", name, err)
+	}
+
+	if len(records) < 1 {
+		if !create {
+			return RecordResult{Name: name, Action: "failed"}, fmt.Errorf("no CNAME records found for '%s'", name)
+		}
+		if !u.inUpdateWindow(name) {
+			return RecordResult{Name: name, Action: "outside_window"}, nil
+		}
+		u.logger.Infof("CNAME '%s' does not exist, creating it...\n", name)
+		_, err := u.client().CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{
+			Type:    "CNAME",
+			Name:    name,
+			Content: target,
+		})
+		u.breaker.Record(err)
+		if err != nil {
+			return RecordResult{Name: name, Action: "failed"}, fmt.Errorf("could not create CNAME '%s' in zone '%s': %w", name, u.config.ZoneName, err)
+		}
+		u.logger.Infof("CNAME '%s' has been created pointing at '%s'\n", name, target)
+		return RecordResult{Name: name, Action: "created", Content: target}, nil
+	}
+
+	record := records[len(records)-1]
+	if contentMatches(record.Type, record.Content, target) {
+		u.logger.Infof("CNAME '%s' already points at '%s'\n", name, target)
+		return RecordResult{Name: name, Action: "unchanged", Content: record.Content}, nil
+	}
+
+	if !u.inUpdateWindow(name) {
+		return RecordResult{Name: name, Action: "outside_window", Content: record.Content}, nil
+	}
+	u.logger.Infof("CNAME '%s' points at '%s' instead of '%s', updating...\n", name, record.Content, target)
+	_, err = u.client().UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{
+		ID:      record.ID,
+		Content: target,
+	})
+	u.breaker.Record(err)
+	if err != nil {
+		return RecordResult{Name: name, Action: "failed", Content: record.Content}, fmt.Errorf("could not update CNAME '%s' in zone '%s': %w", name, u.config.ZoneName, err)
+	}
+	return RecordResult{Name: name, Action: "updated", Content: target, PreviousContent: record.Content}, nil
+}
+
+// ensureWWWCNAME makes sure www.<apex> is a CNAME pointing at the apex record,
+// creating it if it does not exist yet.
+func (u *Updater) ensureWWWCNAME(ctx context.Context, rc *cloudflare.ResourceContainer, check *Check) error {
+	result, err := u.ensureCNAME(ctx, rc, "www."+u.config.RecordName, u.config.RecordName, true)
+	check.Records = append(check.Records, result)
+	return err
+}
+
+// updateCNAMETarget keeps the record pointed at the configured hostname instead
+// of an ip address. At the zone apex cloudflare flattens the CNAME, so the apex
+// resolves to whatever the target currently resolves to.
+func (u *Updater) updateCNAMETarget(ctx context.Context, check *Check) error {
+	check.RecordType = "CNAME"
+
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+
+	if contentMatches("CNAME", u.config.RecordName, u.config.ZoneName) {
+		u.logger.Infof("'%s' is the zone apex, cloudflare will flatten the CNAME to '%s'\n", u.config.RecordName, u.config.CNAMETarget)
+	}
+
+	result, err := u.ensureCNAME(ctx, rc, u.config.RecordName, u.config.CNAMETarget, false)
+	check.Records = append(check.Records, result)
+	return err
+}
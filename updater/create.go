@@ -0,0 +1,86 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// missingRecordError is returned by managedRecords if a name has no record of
+// the type, with CreateMissing it is created.
+type missingRecordError struct {
+	record_type string
+	name        string
+	alias       bool
+}
+
+func (e *missingRecordError) Error() string {
+	if e.alias {
+		return fmt.Sprintf("no %s records found for alias '%s'", e.record_type, e.name)
+	}
+	return fmt.Sprintf("no %s records found for '%s'", e.record_type, e.name)
+}
+
+// createRecord creates a record of the type pointing at current_ip, with the
+// desired proxied, ttl and comment settings.
+func (u *Updater) createRecord(ctx context.Context, rc *cloudflare.ResourceContainer, record_type string, name string, current_ip net.IP) (cloudflare.DNSRecord, error) {
+	proxied := u.config.ExpectProxied
+	params := cloudflare.CreateDNSRecordParams{
+		Type:    record_type,
+		Name:    name,
+		Content: recordContent(record_type, current_ip),
+		Proxied: &proxied,
+		Comment: u.desiredComment(cloudflare.DNSRecord{}),
+	}
+	// proxied records always have an automatic ttl
+	if !proxied {
+		params.TTL = u.config.RecordTTL
+	}
+	record, err := u.client().CreateDNSRecord(ctx, rc, params)
+	u.breaker.Record(err)
+	if err != nil {
+		return record, fmt.Errorf("could not create record '%s' in zone '%s': %w", name, u.config.ZoneName, err)
+	}
+	u.recordWrite(record)
+	return record, nil
+}
+
+// managedOrCreatedRecords returns the managed records like managedRecords,
+// creating the missing ones first if CreateMissing is enabled for the record
+// type, and the ids of the records it created. Every record type decides on
+// its own, in dual-stack mode a missing AAAA record is created while the
+// existing A record is updated.
+func (u *Updater) managedOrCreatedRecords(ctx context.Context, rc *cloudflare.ResourceContainer, record_type string, current_ip net.IP, check *Check) ([]cloudflare.DNSRecord, map[string]bool, error) {
+	created := map[string]bool{}
+	created_names := map[string]bool{}
+	for {
+		targets, err := u.managedRecords(ctx, rc, record_type)
+		var missing *missingRecordError
+		if !errors.As(err, &missing) || !u.config.CreateMissing[record_type] {
+			return targets, created, err
+		}
+		if created_names[missing.name] {
+			return nil, nil, fmt.Errorf("record '%s' has been created, but is not listed yet: %w", missing.name, err)
+		}
+
+		// nothing is written outside of the window, not even the records
+		// that exist
+		if !u.inUpdateWindow(missing.name) {
+			check.Records = append(check.Records, RecordResult{Name: missing.name, Action: "outside_window"})
+			return nil, created, nil
+		}
+		u.logger.Infof("%s record '%s' is missing, creating it with %s...\n", record_type, missing.name, current_ip.String())
+		record, err := u.createRecord(ctx, rc, record_type, missing.name, current_ip)
+		if err != nil {
+			check.Records = append(check.Records, RecordResult{Name: missing.name, Action: "failed"})
+			return nil, nil, err
+		}
+		u.logger.Infof("record '%s' has been created\n", missing.name)
+		check.Records = append(check.Records, RecordResult{Name: missing.name, Action: "created", Content: current_ip.String()})
+		created[record.ID] = true
+		created_names[missing.name] = true
+	}
+}
@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestCreateMissingDualStack(t *testing.T) {
+	// the A record exists, the AAAA record does not yet
+	tests := []struct {
+		name           string
+		create_missing map[string]bool
+		a_content      string
+		a_action       string
+		aaaa_action    string
+	}{
+		{"nothing created", nil, "198.51.100.1", "updated", ""},
+		{"A created", map[string]bool{"A": true}, "198.51.100.1", "updated", ""},
+		{"AAAA created", map[string]bool{"AAAA": true}, "198.51.100.1", "updated", "created"},
+		{"both created", map[string]bool{"A": true, "AAAA": true}, "198.51.100.1", "updated", "created"},
+		{"AAAA created, A unchanged", map[string]bool{"AAAA": true}, "198.51.100.7", "unchanged", "created"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, server := newFakeAPI(t, cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: test.a_content, TTL: 1})
+			u := newTestUpdater(t, server, Config{RecordName: "home", Families: []string{"4", "6"}, CreateMissing: test.create_missing, RecordTTL: 120}, "")
+
+			a_check := Check{RecordType: "A"}
+			if err := u.applyIP(context.Background(), "4", net.ParseIP("198.51.100.7"), 0, &a_check); err != nil {
+				t.Fatalf("applyIP() of the A record failed: %s", err.Error())
+			}
+			if got := actions(a_check); strings.Join(got, ",") != "home.example.com:"+test.a_action {
+				t.Errorf("actions of the A record are %v, want [home.example.com:%s]", got, test.a_action)
+			}
+
+			aaaa_check := Check{RecordType: "AAAA"}
+			err := u.applyIP(context.Background(), "6", net.ParseIP("2001:db8::1"), 0, &aaaa_check)
+			if test.aaaa_action == "" {
+				var missing *missingRecordError
+				if !errors.As(err, &missing) {
+					t.Errorf("applyIP() of the missing AAAA record returned %v, want it missing", err)
+				}
+				if creates := api.Creates(); len(creates) > 0 {
+					t.Errorf("created %v, creating AAAA records is not enabled", creates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyIP() of the AAAA record failed: %s", err.Error())
+			}
+			if got := actions(aaaa_check); strings.Join(got, ",") != "home.example.com:"+test.aaaa_action {
+				t.Errorf("actions of the AAAA record are %v, want [home.example.com:%s]", got, test.aaaa_action)
+			}
+			creates := api.Creates()
+			if len(creates) != 1 || creates[0].Type != "AAAA" || creates[0].Name != "home.example.com" || creates[0].Content != "2001:db8::1" || creates[0].TTL != 120 {
+				t.Fatalf("created %v, want the AAAA record home.example.com of 2001:db8::1 with ttl 120", creates)
+			}
+			// the created record is not updated right after
+			for _, id := range api.Patches() {
+				if id == creates[0].ID {
+					t.Errorf("the created record was updated too")
+				}
+			}
+		})
+	}
+}
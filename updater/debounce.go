@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"sync"
+)
+
+// DetectionRing remembers the most recently detected ip addresses of one
+// family, so a change is only applied once it has been observed repeatedly.
+type DetectionRing struct {
+	mutex sync.Mutex
+	ips   []string
+	next  int
+	count int
+}
+
+func NewDetectionRing(size int) *DetectionRing {
+	return &DetectionRing{ips: make([]string, size)}
+}
+
+// Observe records a detected ip and returns how many of the most recent
+// detections in a row, including this one, were that same ip.
+func (r *DetectionRing) Observe(ip string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ips[r.next] = ip
+	r.next = (r.next + 1) % len(r.ips)
+	if r.count < len(r.ips) {
+		r.count++
+	}
+
+	consecutive := 0
+	for i := 1; i <= r.count; i++ {
+		if r.ips[(r.next-i+len(r.ips))%len(r.ips)] != ip {
+			break
+		}
+		consecutive++
+	}
+	return consecutive
+}
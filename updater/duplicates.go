@@ -0,0 +1,28 @@
+package updater
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// errDuplicatesSkipped is returned by managedRecords with the duplicate
+// records of the "skip" multi record strategy.
+var errDuplicatesSkipped = errors.New("duplicate records are skipped")
+
+// logDuplicates logs the records of the managed name, loudly if they differ
+// in content, a partial round-robin the multi record strategy acts on.
+func (u *Updater) logDuplicates(records []cloudflare.DNSRecord) {
+	contents := []string{}
+	differ := false
+	for _, record := range records {
+		contents = append(contents, record.ID+"="+record.Content)
+		differ = differ || !contentMatches(record.Type, record.Content, records[0].Content)
+	}
+	if !differ {
+		u.logger.Infof("found %d %s records for '%s' with the same content: [%s]\n", len(records), records[0].Type, u.config.RecordName, strings.Join(contents, ", "))
+		return
+	}
+	u.logger.Warnf("!!! found %d %s records for '%s' with differing content: [%s] !!!\n", len(records), records[0].Type, u.config.RecordName, strings.Join(contents, ", "))
+}
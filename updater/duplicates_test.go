@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReconcileDuplicates(t *testing.T) {
+	// the policies of RECONCILE_DUPLICATES and the strategies they are
+	tests := []struct {
+		policy   string
+		strategy string
+		patches  []string
+		actions  []string
+	}{
+		{"collapse", "all", []string{"a1", "a3"}, []string{"updated", "unchanged", "updated"}},
+		{"first", "first", []string{"a1"}, []string{"updated"}},
+		{"skip", "skip", []string{}, []string{"skipped", "skipped", "skipped"}},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			// a partial round-robin, a2 already has the current ip
+			api, server := newFakeAPI(t, homeRecords("198.51.100.1", "198.51.100.7", "198.51.100.2")...)
+			logger := &testLogger{}
+			u := newTestUpdater(t, server, Config{RecordName: "home", MultiRecordStrategy: test.strategy, Logger: logger}, "198.51.100.7")
+
+			result, err := u.UpdateOnce(context.Background())
+			if err != nil {
+				t.Fatalf("UpdateOnce() failed: %s", err.Error())
+			}
+			if !logger.Logged("with differing content: [a1=198.51.100.1, a2=198.51.100.7, a3=198.51.100.2]") {
+				t.Errorf("the differing duplicates were not logged")
+			}
+			if patches := api.Patches(); strings.Join(patches, ",") != strings.Join(test.patches, ",") {
+				t.Errorf("updated %v, want %v", patches, test.patches)
+			}
+			got := []string{}
+			for _, record := range result.Checks[0].Records {
+				got = append(got, record.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(test.actions, ",") {
+				t.Errorf("actions are %v, want %v", got, test.actions)
+			}
+		})
+	}
+}
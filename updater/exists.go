@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// MissingRecords lists the managed records that do not exist in the zone, to
+// catch records deleted out-of-band that an up-to-date ip would never touch.
+// It only reads records and does not detect the ip.
+func (u *Updater) MissingRecords(ctx context.Context) ([]string, error) {
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.config.LookupStrategy == LookupID {
+		_, err := u.client().GetDNSRecord(ctx, rc, u.config.RecordID)
+		u.breaker.Record(err)
+		var not_found_error *cloudflare.NotFoundError
+		if errors.As(err, &not_found_error) {
+			return []string{"record id " + u.config.RecordID}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read record '%s': %w", u.config.RecordID, err)
+		}
+		return nil, nil
+	}
+
+	missing := []string{}
+	for _, family := range u.config.Families {
+		record_types := []string{recordTypeForFamily(family)}
+		if u.config.CNAMETarget != "" {
+			record_types = []string{"CNAME"}
+		} else if family == "" {
+			record_types = []string{"A", "AAAA"}
+		}
+
+		names := append([]string{u.config.RecordName}, u.config.RecordAliases...)
+		for _, name := range names {
+			exists := false
+			for _, record_type := range record_types {
+				params := cloudflare.ListDNSRecordsParams{Type: record_type, Name: name}
+				if name == u.config.RecordName {
+					params = u.recordsParams(record_type)
+				}
+				records, _, err := u.client().ListDNSRecords(ctx, rc, params)
+				u.breaker.Record(err)
+				if err != nil {
+					return nil, fmt.Errorf("could not list records for '%s': %w", name, err)
+				}
+				if len(records) > 0 {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				missing = append(missing, strings.Join(record_types, "/")+" "+name)
+			}
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rtf_gateway is the route flag of routes via a gateway, see route.h
+const rtf_gateway = 0x2
+
+// gatewayMAC returns the mac address of the IPv4 default gateway, read from
+// /proc/net/route and the arp table in /proc/net/arp. It is only available on
+// linux.
+func gatewayMAC() (net.HardwareAddr, error) {
+	routes, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	var gateway net.IP
+	scanner := bufio.NewScanner(bytes.NewReader(routes))
+	for scanner.Scan() {
+		// iface destination gateway flags ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseInt(fields[3], 16, 32)
+		if err != nil || flags&rtf_gateway == 0 {
+			continue
+		}
+		address, err := hex.DecodeString(fields[2])
+		if err != nil || len(address) != net.IPv4len {
+			continue
+		}
+		// the kernel writes the address in host byte order
+		gateway = net.IPv4(address[3], address[2], address[1], address[0])
+		break
+	}
+	if gateway == nil {
+		return nil, errors.New("there is no IPv4 default gateway")
+	}
+
+	arp, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	scanner = bufio.NewScanner(bytes.NewReader(arp))
+	for scanner.Scan() {
+		// ip hw_type flags hw_address mask device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !gateway.Equal(net.ParseIP(fields[0])) {
+			continue
+		}
+		// flags 0x0 is an incomplete entry
+		if fields[2] == "0x0" {
+			break
+		}
+		return net.ParseMAC(fields[3])
+	}
+	return nil, fmt.Errorf("the mac address of gateway %s is not known", gateway.String())
+}
+
+// onExpectedNetwork reports whether the default gateway has the expected mac
+// address, so a roaming device only updates the records at home. A gateway
+// that can not be checked is not the expected one.
+func (u *Updater) onExpectedNetwork() bool {
+	if u.config.ExpectedGatewayMAC == nil {
+		return true
+	}
+	mac, err := gatewayMAC()
+	if err != nil {
+		u.logger.Infof("not updating any records, the gateway could not be checked: %s\n", err.Error())
+		return false
+	}
+	if !bytes.Equal(mac, u.config.ExpectedGatewayMAC) {
+		u.logger.Infof("not updating any records, the gateway %s is not the expected %s\n", mac.String(), u.config.ExpectedGatewayMAC.String())
+		return false
+	}
+	return true
+}
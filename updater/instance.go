@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// instance_stamp prefixes the instance id in the comment of a record
+const instance_stamp = "ddns-instance:"
+
+// desiredComment is the comment a record should have, the desired comment or
+// else its current one, stamped with the instance id if one is configured.
+func (u *Updater) desiredComment(record cloudflare.DNSRecord) string {
+	if u.config.InstanceID == "" {
+		return u.config.DesiredComment
+	}
+	comment := u.config.DesiredComment
+	if comment == "" {
+		comment = record.Comment
+		if index := strings.LastIndex(comment, instance_stamp); index >= 0 {
+			_, rest, _ := strings.Cut(comment[index:], " ")
+			comment = comment[:index] + rest
+		}
+	}
+	return strings.TrimSpace(strings.TrimSpace(comment) + " " + instance_stamp + u.config.InstanceID)
+}
+
+// withInstance stamps the instance id into the comment of a write, if the
+// write does not set the comment already.
+func (u *Updater) withInstance(record cloudflare.DNSRecord, params *cloudflare.UpdateDNSRecordParams) {
+	if u.config.InstanceID == "" || params.Comment != nil {
+		return
+	}
+	if comment := u.desiredComment(record); comment != record.Comment {
+		params.Comment = &comment
+	}
+}
+
+// instanceOf returns the instance id stamped in a comment, if any.
+func instanceOf(comment string) string {
+	index := strings.LastIndex(comment, instance_stamp)
+	if index < 0 {
+		return ""
+	}
+	instance, _, _ := strings.Cut(comment[index+len(instance_stamp):], " ")
+	return instance
+}
+
+// warnConflict warns loudly if another instance changed the record within the
+// last two intervals, two instances managing the same record fight each other.
+// Instances sharing a lock take turns instead.
+func (u *Updater) warnConflict(record cloudflare.DNSRecord, family string) {
+	if u.config.InstanceID == "" || u.config.HALock != "" {
+		return
+	}
+	instance := instanceOf(record.Comment)
+	if instance == "" || instance == u.config.InstanceID {
+		return
+	}
+	since := u.clock.Now().Sub(record.ModifiedOn)
+	if since > 2*u.interval(family) {
+		return
+	}
+	u.logger.Warnf("!!! record '%s' was changed %s ago by instance '%s', another updater seems to manage it too and they will fight over it !!!\n", record.Name, since.Round(time.Second).String(), instance)
+}
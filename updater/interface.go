@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ipv6 address flags of the linux kernel, see if_addr.h
+const (
+	ifa_f_temporary  = 0x01
+	ifa_f_deprecated = 0x20
+	ifa_f_tentative  = 0x40
+)
+
+// ipv6Flags reads the flags of the IPv6 addresses of an interface from
+// /proc/net/if_inet6, keyed by the 16 byte address. It is only available on
+// linux, elsewhere the map is nil.
+func ipv6Flags(name string) (map[string]int, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+	file, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	flags := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// address index prefix_length scope flags name
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[5] != name {
+			continue
+		}
+		address, err := hex.DecodeString(fields[0])
+		if err != nil || len(address) != net.IPv6len {
+			continue
+		}
+		flag, err := strconv.ParseInt(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags[string(address)] = int(flag)
+	}
+	return flags, scanner.Err()
+}
+
+// interfaceIP takes the current ip from the addresses of the configured
+// interface, only global addresses are candidates. Of the IPv6 addresses the
+// stable ones are preferred over temporary privacy extension addresses, or the
+// other way around with PreferTemporary. Address flags are only known on
+// linux, elsewhere the first global address is taken.
+func (u *Updater) interfaceIP(family string) (net.IP, error) {
+	iface, err := net.InterfaceByName(u.config.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("could not find interface '%s': %w", u.config.Interface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the addresses of interface '%s': %w", u.config.Interface, err)
+	}
+	flags, err := ipv6Flags(u.config.Interface)
+	if err != nil {
+		u.logger.Warnf("ipv6 address flags could not be read, not telling temporary addresses apart: %s\n", err.Error())
+	}
+
+	preferred, fallback := []net.IP{}, []net.IP{}
+	for _, addr := range addrs {
+		ip_net, ok := addr.(*net.IPNet)
+		if !ok || !ip_net.IP.IsGlobalUnicast() {
+			continue
+		}
+		ip := ip_net.IP
+		if family == "4" && ip.To4() == nil || family == "6" && ip.To4() != nil {
+			continue
+		}
+		if ip.To4() != nil {
+			preferred = append(preferred, ip.To4())
+			continue
+		}
+		// unique local addresses are not reachable from the internet
+		if ip.IsPrivate() {
+			continue
+		}
+		flag := flags[string(ip.To16())]
+		if flag&(ifa_f_deprecated|ifa_f_tentative) != 0 {
+			continue
+		}
+		if (flag&ifa_f_temporary != 0) == u.config.PreferTemporary {
+			preferred = append(preferred, ip)
+		} else {
+			fallback = append(fallback, ip)
+		}
+	}
+
+	if len(preferred) > 0 {
+		return preferred[0], nil
+	}
+	if len(fallback) > 0 {
+		kind := "temporary"
+		if u.config.PreferTemporary {
+			kind = "stable"
+		}
+		u.logger.Warnf("interface '%s' only has %s IPv6 addresses, using %s\n", u.config.Interface, kind, fallback[0].String())
+		return fallback[0], nil
+	}
+	if family == "" {
+		return nil, fmt.Errorf("interface '%s' has no global address", u.config.Interface)
+	}
+	return nil, fmt.Errorf("interface '%s' has no global IPv%s address", u.config.Interface, family)
+}
@@ -0,0 +1,41 @@
+package updater
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// cachedIP is an ip detected by fetchIP, see Config.IPCacheTTL.
+type cachedIP struct {
+	ip         net.IP
+	fetched_at time.Time
+}
+
+// cachedFetchIP returns the ip fetched for a family within the last
+// IPCacheTTL, fetching it again once the cached one expired. Failures are not
+// cached.
+func (u *Updater) cachedFetchIP(ctx context.Context, family string) (net.IP, error) {
+	if u.config.IPCacheTTL <= 0 {
+		return u.fetchIP(ctx, family)
+	}
+
+	u.ip_cache_mutex.Lock()
+	cached, exists := u.ip_cache[family]
+	u.ip_cache_mutex.Unlock()
+	if exists {
+		if age := u.clock.Now().Sub(cached.fetched_at); age < u.config.IPCacheTTL {
+			u.logger.Infof("using %s fetched %s ago, not asking the endpoints until it is %s old\n", cached.ip.String(), age.Round(time.Second).String(), u.config.IPCacheTTL.String())
+			return cached.ip, nil
+		}
+	}
+
+	ip, err := u.fetchIP(ctx, family)
+	if err != nil {
+		return nil, err
+	}
+	u.ip_cache_mutex.Lock()
+	u.ip_cache[family] = cachedIP{ip: ip, fetched_at: u.clock.Now()}
+	u.ip_cache_mutex.Unlock()
+	return ip, nil
+}
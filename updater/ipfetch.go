@@ -0,0 +1,393 @@
+package updater
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPEndpoint is a reflector returning the public ip of the caller, optionally
+// tagged with the ip family ("4" or "6") it is supposed to report.
+type IPEndpoint struct {
+	URL    string
+	Family string
+	// Priority orders the endpoints, lower ones are asked first and
+	// endpoints of the same priority round-robin.
+	Priority int
+	// Verify endpoints are never a source of the ip, they are asked to
+	// cross-check the answer of the others instead, see fetchIP.
+	Verify bool
+}
+
+// ParseIPEndpoints parses a comma separated list of endpoints, each of which
+// may be prefixed with its family and followed by options, e.g.
+// "4=https://ipv4.icanhazip.com priority=1" or "https://ifconfig.me verify".
+func ParseIPEndpoints(endpoints_string string) ([]IPEndpoint, error) {
+	endpoints := []IPEndpoint{}
+	for _, entry := range SplitList(endpoints_string) {
+		fields := strings.Fields(entry)
+		if len(fields) < 1 {
+			continue
+		}
+		endpoint := IPEndpoint{URL: fields[0]}
+		if family, url, tagged := strings.Cut(fields[0], "="); tagged && (family == "4" || family == "6") {
+			endpoint.Family = family
+			endpoint.URL = url
+		}
+		for _, option := range fields[1:] {
+			if priority_string, found := strings.CutPrefix(option, "priority="); found {
+				priority, err := strconv.Atoi(priority_string)
+				if err != nil {
+					return nil, fmt.Errorf("priority '%s' of endpoint '%s' is not an integer", priority_string, endpoint.URL)
+				}
+				endpoint.Priority = priority
+			} else if option == "verify" {
+				endpoint.Verify = true
+			} else {
+				return nil, fmt.Errorf("option '%s' of endpoint '%s' is not supported, use 'priority=<n>' or 'verify'", option, endpoint.URL)
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if len(endpoints) < 1 {
+		return nil, errors.New("no endpoints given")
+	}
+	for _, endpoint := range endpoints {
+		if !endpoint.Verify {
+			return endpoints, nil
+		}
+	}
+	return nil, errors.New("every endpoint is verify-only")
+}
+
+// ErrFamilyMismatch is wrapped by the errors of ip sources that returned an
+// address of the other family than the record needs.
+var ErrFamilyMismatch = errors.New("address of the wrong ip family")
+
+// onlyFamilyMismatches reports whether every joined error of an ip detection
+// is a family mismatch, as on a single-stack network.
+func onlyFamilyMismatches(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if !onlyFamilyMismatches(err) {
+				return false
+			}
+		}
+		return len(joined.Unwrap()) > 0
+	}
+	return errors.Is(err, ErrFamilyMismatch)
+}
+
+// ErrEndpointTLS is wrapped by the errors of endpoints whose certificate could
+// not be verified, as opposed to network errors.
+var ErrEndpointTLS = errors.New("tls verification of the ip info endpoint failed")
+
+func isTLSVerificationError(err error) bool {
+	var verification_error *tls.CertificateVerificationError
+	var unknown_authority_error x509.UnknownAuthorityError
+	var hostname_error x509.HostnameError
+	var invalid_error x509.CertificateInvalidError
+	return errors.As(err, &verification_error) || errors.As(err, &unknown_authority_error) || errors.As(err, &hostname_error) || errors.As(err, &invalid_error)
+}
+
+// max_ip_response_size caps how much of a response is read, an ip address
+// needs a few dozen bytes so anything larger is a broken or hostile endpoint
+const max_ip_response_size = 4 * 1024
+
+func networkForFamily(family string) string {
+	switch family {
+	case "4":
+		return "tcp4"
+	case "6":
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// default_ip_max_redirects is how many redirects of an endpoint are followed
+// by default, e.g. http to https and a trailing slash
+const default_ip_max_redirects = 5
+
+func (u *Updater) newIPClient(network string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		if u.resolve_cache != nil {
+			return u.resolve_cache.dial(ctx, dialer, network, address)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport, CheckRedirect: u.checkRedirect}
+}
+
+// checkRedirect caps the redirect chain of an endpoint, so a redirect loop
+// fails the endpoint instead of stalling the update.
+func (u *Updater) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) > u.config.IPMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", u.config.IPMaxRedirects)
+	}
+	u.logger.Infof("ip info endpoint '%s' redirected to '%s'\n", via[0].URL.String(), request.URL.String())
+	return nil
+}
+
+// endpointsForFamily returns the indices of all endpoints usable for the
+// given family, untagged endpoints are usable for any family. Verify
+// endpoints are left out, see verifiersForFamily.
+func (u *Updater) endpointsForFamily(family string) []int {
+	return u.filterEndpoints(family, false)
+}
+
+// verifiersForFamily returns the indices of the verify endpoints usable for
+// the given family.
+func (u *Updater) verifiersForFamily(family string) []int {
+	return u.filterEndpoints(family, true)
+}
+
+func (u *Updater) filterEndpoints(family string, verify bool) []int {
+	indices := []int{}
+	for i, endpoint := range u.config.Endpoints {
+		if endpoint.Verify != verify {
+			continue
+		}
+		if endpoint.Family == "" || family == "" || endpoint.Family == family {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func (u *Updater) requestIP(ctx context.Context, endpoint IPEndpoint, family string) (net.IP, error) {
+	network := networkForFamily(family)
+	if endpoint.Family != "" {
+		network = networkForFamily(endpoint.Family)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error when requesting the current ip: %w", err)
+	}
+	ip_response, err := u.ip_clients[network].Do(request)
+	if err != nil {
+		if isTLSVerificationError(err) {
+			return nil, fmt.Errorf("%w: %w", ErrEndpointTLS, err)
+		}
+		return nil, fmt.Errorf("error when requesting the current ip: %w", err)
+	}
+	defer ip_response.Body.Close()
+
+	// a body failing partway is a failure of this endpoint like any other, the
+	// partial data is never parsed
+	ip_bytes, err := io.ReadAll(io.LimitReader(ip_response.Body, max_ip_response_size))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the body of the ip request response after %d bytes: %w", len(ip_bytes), err)
+	}
+
+	if family == "" {
+		family = endpoint.Family
+	}
+	return u.parseIP(string(ip_bytes), "endpoint '"+endpoint.URL+"'", family)
+}
+
+// parseIP validates an ip reported by source for the given family ("" for any
+// family), an address in IgnoreIPs is a failure.
+func (u *Updater) parseIP(text string, source string, family string) (net.IP, error) {
+	ip_string := strings.TrimSpace(text)
+	current_ip := net.ParseIP(ip_string)
+	if current_ip == nil {
+		return nil, fmt.Errorf("current IP address could not be parsed from '%s'", text)
+	}
+
+	for _, ignored := range u.config.IgnoreIPs {
+		if ignored.Contains(current_ip) {
+			u.logger.Errorf("!!! %s returned %s, which is in the ignored range %s, treating it as a failure !!!\n", source, current_ip.String(), ignored.String())
+			return nil, fmt.Errorf("%s returned the ignored address %s", source, current_ip.String())
+		}
+	}
+
+	// net.IP does not tell ::ffff:1.2.3.4 from 1.2.3.4, only the text does
+	if strings.Contains(ip_string, ":") && current_ip.To4() != nil {
+		if family != "6" {
+			u.logger.Infof("%s returned the IPv4-mapped address %s, using %s\n", source, ip_string, current_ip.To4().String())
+			return current_ip.To4(), nil
+		}
+		if !u.config.AllowMappedIPv6 {
+			return nil, fmt.Errorf("%w, %s returned the IPv4-mapped address %s, which is not an IPv6 address of its own", ErrFamilyMismatch, source, ip_string)
+		}
+		return current_ip, nil
+	}
+	if family == "4" && current_ip.To4() == nil || family == "6" && current_ip.To4() != nil {
+		return nil, fmt.Errorf("%w, %s returned %s, which is not an IPv%s address", ErrFamilyMismatch, source, current_ip.String(), family)
+	}
+
+	return current_ip, nil
+}
+
+// givenIP takes the current ip from Config.CurrentIP, validated like the ip of
+// an endpoint.
+func (u *Updater) givenIP(family string) (net.IP, error) {
+	text, err := u.config.CurrentIP()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the given ip: %w", err)
+	}
+	return u.parseIP(text, "the given ip source", family)
+}
+
+// fetchIP requests the current ip of the given family ("" for any family)
+// from the configured endpoints. The endpoints are tried by priority, those of
+// the same priority round-robin starting after the one that last answered for
+// this family, falling back to the next one on failure. The answer is then
+// cross-checked with the verify endpoints, see verifyIP.
+func (u *Updater) fetchIP(ctx context.Context, family string) (net.IP, error) {
+	indices := u.endpointsForFamily(family)
+	if len(indices) < 1 {
+		return nil, fmt.Errorf("no ip info endpoints configured for IPv%s", family)
+	}
+
+	u.ip_endpoint_mutex.Lock()
+	start := 0
+	if last, exists := u.ip_endpoint_last[family]; exists {
+		for position, index := range indices {
+			if index == last {
+				start = (position + 1) % len(indices)
+			}
+		}
+	}
+	u.ip_endpoint_mutex.Unlock()
+
+	order := []int{}
+	for offset := range indices {
+		order = append(order, indices[(start+offset)%len(indices)])
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return u.config.Endpoints[order[i]].Priority < u.config.Endpoints[order[j]].Priority
+	})
+
+	errs := []error{}
+	for _, index := range order {
+		endpoint := u.config.Endpoints[index]
+
+		current_ip, err := u.requestIP(ctx, endpoint, family)
+		if err != nil && errors.Is(err, ErrEndpointTLS) {
+			u.logger.Errorf("!!! certificate of ip info endpoint '%s' could not be verified: %s !!!\n", endpoint.URL, err.Error())
+			if u.config.StrictTLS {
+				return nil, fmt.Errorf("'%s': %w", endpoint.URL, err)
+			}
+			errs = append(errs, fmt.Errorf("'%s': %w", endpoint.URL, err))
+			continue
+		}
+		if err != nil {
+			u.logger.Warnf("ip info endpoint '%s' failed: %s\n", endpoint.URL, err.Error())
+			errs = append(errs, fmt.Errorf("'%s': %w", endpoint.URL, err))
+			continue
+		}
+
+		u.ip_endpoint_mutex.Lock()
+		u.ip_endpoint_last[family] = index
+		u.ip_endpoint_mutex.Unlock()
+
+		u.logger.Infof("current IP address was reported by '%s'\n", endpoint.URL)
+		if err := u.verifyIP(ctx, family, endpoint, current_ip); err != nil {
+			return nil, err
+		}
+		return current_ip, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// verifyIP asks the verify endpoints for the ip, it is rejected if it
+// disagrees with every verifier that answered. Verifiers that fail are only
+// warned about, so they can not block updates on their own.
+func (u *Updater) verifyIP(ctx context.Context, family string, source IPEndpoint, current_ip net.IP) error {
+	verifiers := u.verifiersForFamily(family)
+	if len(verifiers) < 1 {
+		return nil
+	}
+
+	answered := []string{}
+	for _, index := range verifiers {
+		verifier := u.config.Endpoints[index]
+		verified_ip, err := u.requestIP(ctx, verifier, family)
+		if err != nil {
+			u.logger.Warnf("verify endpoint '%s' failed: %s\n", verifier.URL, err.Error())
+			continue
+		}
+		if verified_ip.Equal(current_ip) {
+			u.logger.Infof("current IP address was verified by '%s'\n", verifier.URL)
+			return nil
+		}
+		answered = append(answered, verifier.URL+" ("+verified_ip.String()+")")
+	}
+	if len(answered) < 1 {
+		u.logger.Warnf("none of the verify endpoints answered, using %s unverified\n", current_ip.String())
+		return nil
+	}
+	u.logger.Errorf("!!! endpoint '%s' returned %s, but every verify endpoint disagrees: %s, skipping the update !!!\n", source.URL, current_ip.String(), strings.Join(answered, ", "))
+	return fmt.Errorf("%s of endpoint '%s' disagrees with every verify endpoint", current_ip.String(), source.URL)
+}
+
+// resolveIP looks up the configured hostname instead of asking an endpoint, to
+// mirror a record of another (dynamic) dns provider. The address is validated
+// like the ip of an endpoint, netip keeps an IPv4-mapped address as such.
+func (u *Updater) resolveIP(ctx context.Context, family string) (net.IP, error) {
+	network := "ip"
+	if family != "" {
+		network = "ip" + family
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, network, u.config.ResolveHostname)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve '%s': %w", u.config.ResolveHostname, err)
+	}
+	if len(addrs) < 1 {
+		return nil, fmt.Errorf("'%s' did not resolve to any address", u.config.ResolveHostname)
+	}
+	current_ip, err := u.parseIP(addrs[0].String(), "hostname '"+u.config.ResolveHostname+"'", family)
+	if err != nil {
+		return nil, err
+	}
+	u.logger.Infof("current IP address was resolved from '%s'\n", u.config.ResolveHostname)
+	return current_ip, nil
+}
+
+// ParseIPNets parses a comma separated list of addresses and CIDR ranges, an
+// address is a range of its own.
+func ParseIPNets(nets_string string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, entry := range SplitList(nets_string) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, ip_net, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a CIDR range", entry)
+			}
+			nets = append(nets, ip_net)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("'%s' is not an ip address", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
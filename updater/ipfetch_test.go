@@ -0,0 +1,150 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newBrokenIPEndpoint announces a whole ip but drops the connection after the
+// first bytes of it.
+func newBrokenIPEndpoint(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Length", "13")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write([]byte("198"))
+		writer.(http.Flusher).Flush()
+		connection, _, err := writer.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("could not hijack the connection: %s", err.Error())
+			return
+		}
+		connection.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRequestIPBodyFailsPartway(t *testing.T) {
+	broken := newBrokenIPEndpoint(t)
+	working := newIPEndpoint(t, "198.51.100.7")
+	_, server := newFakeAPI(t)
+	logger := &testLogger{}
+	u := newTestUpdater(t, server, Config{
+		RecordName: "home",
+		Endpoints:  []IPEndpoint{{URL: broken.URL}, {URL: working.URL}},
+		Logger:     logger,
+	}, "")
+
+	_, err := u.requestIP(context.Background(), IPEndpoint{URL: broken.URL}, "")
+	if err == nil || !strings.Contains(err.Error(), "after 3 bytes") {
+		t.Errorf("requestIP() of the broken endpoint returned %v, want the error after 3 bytes", err)
+	}
+
+	// the broken endpoint comes first and falls back to the next one
+	ip, err := u.fetchIP(context.Background(), "")
+	if err != nil {
+		t.Fatalf("fetchIP() failed: %s", err.Error())
+	}
+	if !ip.Equal(net.ParseIP("198.51.100.7")) {
+		t.Errorf("fetchIP() returned %s, want 198.51.100.7", ip.String())
+	}
+	if !logger.Logged("ip info endpoint '" + broken.URL + "' failed") {
+		t.Errorf("the failure of the broken endpoint was not logged")
+	}
+}
+
+func TestRequestIPMapped(t *testing.T) {
+	tests := []struct {
+		text       string
+		family     string
+		allow      bool
+		content    string
+		mismatches bool
+	}{
+		{"::ffff:198.51.100.7", "", false, "198.51.100.7", false},
+		{"::ffff:198.51.100.7", "4", false, "198.51.100.7", false},
+		{"::ffff:198.51.100.7\n", "4", false, "198.51.100.7", false},
+		{"::ffff:198.51.100.7", "6", false, "", true},
+		{"::ffff:198.51.100.7", "6", true, "::ffff:198.51.100.7", false},
+		{"198.51.100.7", "6", true, "", true},
+		{"2001:db8::1", "4", false, "", true},
+		{"2001:db8::1", "6", false, "2001:db8::1", false},
+	}
+	_, server := newFakeAPI(t)
+	for _, test := range tests {
+		endpoint := newIPEndpoint(t, test.text)
+		u := newTestUpdater(t, server, Config{RecordName: "home", AllowMappedIPv6: test.allow}, "")
+		// the endpoint only listens on IPv4, its family picks the network
+		ip, err := u.requestIP(context.Background(), IPEndpoint{URL: endpoint.URL, Family: "4"}, test.family)
+		if test.mismatches {
+			if !errors.Is(err, ErrFamilyMismatch) {
+				t.Errorf("requestIP() of '%s' for IPv%s returned %v, want a family mismatch", test.text, test.family, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("requestIP() of '%s' for IPv%s failed: %s", test.text, test.family, err.Error())
+			continue
+		}
+		if content := recordContent(recordTypeForFamily(test.family), ip); content != test.content {
+			t.Errorf("requestIP() of '%s' for IPv%s is written as %s, want %s", test.text, test.family, content, test.content)
+		}
+	}
+}
+
+func TestOnlyFamilyMismatches(t *testing.T) {
+	mismatch := fmt.Errorf("%w, test returned 2001:db8::1", ErrFamilyMismatch)
+	failure := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		only bool
+	}{
+		{"nil", nil, false},
+		{"mismatch", mismatch, true},
+		{"wrapped mismatch", fmt.Errorf("'endpoint': %w", mismatch), true},
+		{"failure", failure, false},
+		{"joined mismatches", errors.Join(mismatch, fmt.Errorf("'endpoint': %w", mismatch)), true},
+		{"joined mismatch and failure", errors.Join(mismatch, failure), false},
+		{"nested joined mismatches", errors.Join(errors.Join(mismatch), mismatch), true},
+	}
+	for _, test := range tests {
+		if only := onlyFamilyMismatches(test.err); only != test.only {
+			t.Errorf("onlyFamilyMismatches(%s) = %t, want %t", test.name, only, test.only)
+		}
+	}
+}
+
+// the resolved address is validated like the ip of an endpoint, localhost is
+// 127.0.0.1 in /etc/hosts
+func TestResolveIPValidated(t *testing.T) {
+	_, ignored, _ := net.ParseCIDR("127.0.0.0/8")
+	tests := []struct {
+		ignore  []*net.IPNet
+		family  string
+		content string
+	}{
+		{nil, "4", "127.0.0.1"},
+		{[]*net.IPNet{ignored}, "4", ""},
+	}
+	_, server := newFakeAPI(t)
+	for _, test := range tests {
+		u := newTestUpdater(t, server, Config{RecordName: "home", ResolveHostname: "localhost", IgnoreIPs: test.ignore}, "")
+		ip, err := u.resolveIP(context.Background(), test.family)
+		if test.content == "" {
+			if err == nil || !strings.Contains(err.Error(), "ignored address") {
+				t.Errorf("resolveIP() with ignored %v returned %v, %v, want the ignored address error", test.ignore, ip, err)
+			}
+			continue
+		}
+		if err != nil || ip.String() != test.content {
+			t.Errorf("resolveIP() returned %v, %v, want %s", ip, err, test.content)
+		}
+	}
+}
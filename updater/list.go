@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// ListRecords lists the A and AAAA records of the configured zone, to look up
+// the names and ids to configure. Only APIToken, APIOptions, ZoneName or
+// ZoneID, AccountID and Logger of the config are used.
+func ListRecords(ctx context.Context, config Config) ([]cloudflare.DNSRecord, error) {
+	api, err := cloudflare.NewWithAPIToken(config.APIToken, config.APIOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cloudflare api client with the provided token, %w", err)
+	}
+
+	if config.Logger == nil {
+		config.Logger = cloudflare.SilentLeveledLogger
+	}
+	u := &Updater{config: config, api: api, clock: RealClock{}, logger: config.Logger, zone_id: config.ZoneID}
+	if u.zone_id == "" && zone_id_pattern.MatchString(config.ZoneName) {
+		u.zone_id = config.ZoneName
+	}
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []cloudflare.DNSRecord{}
+	for _, record_type := range []string{"A", "AAAA"} {
+		typed_records, _, err := api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Type: record_type})
+		if err != nil {
+			return nil, fmt.Errorf("could not list %s records of zone '%s': %w", record_type, config.ZoneName, err)
+		}
+		records = append(records, typed_records...)
+	}
+	return records, nil
+}
@@ -0,0 +1,28 @@
+package updater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestListRecords(t *testing.T) {
+	_, server := newFakeAPI(t,
+		cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.7"},
+		cloudflare.DNSRecord{ID: "aaaa", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1"},
+		cloudflare.DNSRecord{ID: "txt", Type: "TXT", Name: "home.example.com", Content: "text"},
+	)
+	// without a Logger, like New defaults to the silent one
+	records, err := ListRecords(context.Background(), Config{
+		APIToken:   "token",
+		ZoneName:   test_zone_name,
+		APIOptions: []cloudflare.Option{cloudflare.BaseURL(server.URL)},
+	})
+	if err != nil {
+		t.Fatalf("ListRecords() failed: %s", err.Error())
+	}
+	if len(records) != 2 || records[0].ID != "a" || records[1].ID != "aaaa" {
+		t.Errorf("ListRecords() returned %v, want the A and the AAAA record", records)
+	}
+}
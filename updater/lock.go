@@ -0,0 +1,111 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// lock_stamp prefixes the content of the lock record, followed by the holding
+// instance and the unix time its lease expires
+const lock_stamp = "ddns-lock"
+
+// lockHolder parses the content of a lock record.
+func lockHolder(content string) (string, time.Time) {
+	fields := strings.Fields(strings.Trim(content, `"`))
+	if len(fields) != 3 || fields[0] != lock_stamp {
+		return "", time.Time{}
+	}
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", time.Time{}
+	}
+	return fields[1], time.Unix(expires, 0)
+}
+
+// holdLock reports whether this instance is the leader, holding the TXT
+// record Config.HALock of the zone. The leader renews its lease of three
+// intervals on every update, a standby takes the lock over once the lease of
+// the leader expired. The api has no conditional writes, so an expired lock
+// is read again right before it is taken and left alone if it was modified
+// since it was listed, and after writing it is read back. Of two instances
+// created at once the oldest lock counts. Two instances can still both
+// lead for one update if one of them writes between the other's second read
+// and its write, the next update sees the last write and the other stands by.
+func (u *Updater) holdLock(ctx context.Context, family string) (bool, error) {
+	if u.config.HALock == "" {
+		return true, nil
+	}
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return false, err
+	}
+	list := func() ([]cloudflare.DNSRecord, error) {
+		records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Type: "TXT", Name: u.config.HALock})
+		u.breaker.Record(err)
+		if err != nil {
+			return nil, fmt.Errorf("could not read lock record '%s': %w", u.config.HALock, err)
+		}
+		// of concurrently created locks the oldest one counts
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].CreatedOn.Before(records[j].CreatedOn)
+		})
+		return records, nil
+	}
+
+	records, err := list()
+	if err != nil {
+		return false, err
+	}
+	now := u.clock.Now()
+	content := fmt.Sprintf("%s %s %d", lock_stamp, u.config.InstanceID, now.Add(3*u.interval(family)).Unix())
+	if len(records) > 0 {
+		holder, expires := lockHolder(records[0].Content)
+		if holder != u.config.InstanceID && now.Before(expires) {
+			u.logger.Infof("instance '%s' holds lock '%s' until %s, standing by\n", holder, u.config.HALock, expires.Format(time.RFC3339))
+			return false, nil
+		}
+		// only an expired lease can be taken by another instance
+		if holder != u.config.InstanceID || !now.Before(expires) {
+			current, err := u.client().GetDNSRecord(ctx, rc, records[0].ID)
+			u.breaker.Record(err)
+			if err != nil {
+				return false, fmt.Errorf("could not read lock record '%s': %w", u.config.HALock, err)
+			}
+			if !current.ModifiedOn.Equal(records[0].ModifiedOn) || current.Content != records[0].Content {
+				holder, _ := lockHolder(current.Content)
+				u.logger.Infof("instance '%s' took lock '%s' at the same time, standing by\n", holder, u.config.HALock)
+				return false, nil
+			}
+		}
+		if holder != u.config.InstanceID {
+			u.logger.Infof("lock '%s' is free, taking it over\n", u.config.HALock)
+		}
+		_, err = u.client().UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{ID: records[0].ID, Content: content})
+	} else {
+		u.logger.Infof("lock '%s' does not exist, taking it\n", u.config.HALock)
+		_, err = u.client().CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{Type: "TXT", Name: u.config.HALock, Content: content})
+	}
+	u.breaker.Record(err)
+	if err != nil {
+		return false, fmt.Errorf("could not write lock record '%s': %w", u.config.HALock, err)
+	}
+
+	records, err = list()
+	if err != nil {
+		return false, err
+	}
+	if len(records) < 1 {
+		return false, fmt.Errorf("lock record '%s' disappeared after writing it", u.config.HALock)
+	}
+	if holder, _ := lockHolder(records[0].Content); holder != u.config.InstanceID {
+		u.logger.Infof("instance '%s' took lock '%s' at the same time, standing by\n", holder, u.config.HALock)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Lookup strategies, how the current content of the records is determined.
+//
+//	list     lists the records through the api on every update (default), always
+//	         accurate but one api call per update even if nothing changed
+//	resolve  resolves the record names through dns first and only asks the api
+//	         if they do not resolve to the current ip, cheapest on the api but
+//	         cached answers may cost an extra api call right after a change,
+//	         and proxied records always need the api, with
+//	         ResolveAuthoritative the zone's own nameservers are asked
+//	id       reads the record given by RecordID directly, one cheap api call
+//	         and no permission to search records needed
+const (
+	LookupList    = "list"
+	LookupResolve = "resolve"
+	LookupID      = "id"
+)
+
+// resolvesTo reports whether the record and its aliases resolve to exactly the
+// current ip through dns, so the api does not need to be asked.
+func (u *Updater) resolvesTo(ctx context.Context, record_type string, current_ip net.IP) bool {
+	network := "ip4"
+	if record_type == "AAAA" {
+		network = "ip6"
+	}
+	for _, name := range append([]string{u.config.RecordName}, u.config.RecordAliases...) {
+		ips, err := u.resolver().LookupIP(ctx, network, name)
+		if err != nil || len(ips) != 1 || !ips[0].Equal(current_ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolver is the resolver of the resolve lookup strategy, the authoritative
+// one if ResolveAuthoritative is set.
+func (u *Updater) resolver() *net.Resolver {
+	if u.authoritative_resolver != nil {
+		return u.authoritative_resolver
+	}
+	return net.DefaultResolver
+}
+
+// newAuthoritativeResolver creates a resolver asking the nameservers of the
+// zone directly, bypassing the caches of recursive resolvers. The next
+// nameserver is tried if one can not be reached.
+func newAuthoritativeResolver(name_servers []string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			errs := []error{}
+			for _, name_server := range name_servers {
+				conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(name_server, "53"))
+				if err == nil {
+					return conn, nil
+				}
+				errs = append(errs, err)
+			}
+			return nil, errors.Join(errs...)
+		},
+	}
+}
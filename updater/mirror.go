@@ -0,0 +1,117 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// Mirror is a record in another zone that is kept at the content applied to
+// the managed records, e.g. the same endpoint under a vanity domain.
+type Mirror struct {
+	Zone   string
+	Record string
+}
+
+func (m Mirror) String() string {
+	return m.Record + " in zone " + m.Zone
+}
+
+// hasContent reports whether a managed record of the check has content.
+func hasContent(check *Check, record_type string, content string) bool {
+	for _, record := range check.Records {
+		if contentMatches(record_type, record.Content, content) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncMirrors sets the mirrors to content, the detected ip the managed
+// records have after the update. The zones of the mirrors are independent, so up to
+// ZoneConcurrency of them are synced at once, the mirrors within a zone one
+// after the other.
+func (u *Updater) syncMirrors(ctx context.Context, record_type string, content string, check *Check) error {
+	zones := []string{}
+	by_zone := map[string][]int{}
+	for index, mirror := range u.config.Mirrors {
+		zone := strings.ToLower(mirror.Zone)
+		if _, exists := by_zone[zone]; !exists {
+			zones = append(zones, zone)
+		}
+		by_zone[zone] = append(by_zone[zone], index)
+	}
+
+	concurrency := max(u.config.ZoneConcurrency, 1)
+	slots := make(chan struct{}, concurrency)
+	results := make([]RecordResult, len(u.config.Mirrors))
+	errs := make([]error, len(u.config.Mirrors))
+	wait := sync.WaitGroup{}
+	for _, zone := range zones {
+		wait.Add(1)
+		slots <- struct{}{}
+		go func(indices []int) {
+			defer func() { <-slots; wait.Done() }()
+			for _, index := range indices {
+				results[index], errs[index] = u.syncMirror(ctx, u.config.Mirrors[index], record_type, content)
+			}
+		}(by_zone[zone])
+	}
+	wait.Wait()
+
+	check.Records = append(check.Records, results...)
+	if concurrency > 1 {
+		actions := map[string]int{}
+		for _, result := range results {
+			actions[result.Action]++
+		}
+		u.logger.Infof("synced %d mirrors in %d zones, %d at once: %d updated, %d unchanged, %d failed\n", len(results), len(zones), concurrency, actions["updated"], actions["unchanged"], actions["failed"])
+	}
+	return errors.Join(errs...)
+}
+
+func (u *Updater) syncMirror(ctx context.Context, mirror Mirror, record_type string, content string) (RecordResult, error) {
+	zones, err := u.listZones(ctx, mirror.Zone)
+	u.breaker.Record(err)
+	if err != nil {
+		return RecordResult{Name: mirror.Record, Action: "failed"}, fmt.Errorf("could not list zones for mirror '%s': %w", mirror.String(), err)
+	}
+	if len(zones) < 1 {
+		return RecordResult{Name: mirror.Record, Action: "failed"}, fmt.Errorf("no zones found for mirror '%s'", mirror.String())
+	}
+	rc := cloudflare.ZoneIdentifier(zones[len(zones)-1].ID)
+
+	records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Type: record_type, Name: mirror.Record})
+	u.breaker.Record(err)
+	if err != nil {
+		return RecordResult{Name: mirror.Record, Action: "failed"}, fmt.Errorf("could not list records for mirror '%s': %w", mirror.String(), err)
+	}
+	if len(records) < 1 {
+		return RecordResult{Name: mirror.Record, Action: "failed"}, fmt.Errorf("no %s records found for mirror '%s'", record_type, mirror.String())
+	}
+
+	record := records[len(records)-1]
+	if contentMatches(record.Type, record.Content, content) {
+		u.logger.Infof("mirror '%s' is already up-to-date\n", mirror.String())
+		return RecordResult{Name: record.Name, Action: "unchanged", Content: record.Content}, nil
+	}
+
+	if !u.inUpdateWindow(record.Name) {
+		return RecordResult{Name: record.Name, Action: "outside_window", Content: record.Content}, nil
+	}
+	u.logger.Infof("mirror '%s' is %s instead of %s, updating...\n", mirror.String(), record.Content, content)
+	updated_record, err := u.client().UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{
+		ID:      record.ID,
+		Content: content,
+	})
+	u.breaker.Record(err)
+	if err != nil {
+		return RecordResult{Name: record.Name, Action: "failed", Content: record.Content}, fmt.Errorf("could not update mirror '%s': %w", mirror.String(), err)
+	}
+	u.logChange(fmt.Sprintf("mirror '%s' has been successfully updated", mirror.String()), record, updated_record)
+	return RecordResult{Name: record.Name, Action: "updated", Content: updated_record.Content, PreviousContent: record.Content}, nil
+}
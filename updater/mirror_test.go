@@ -0,0 +1,44 @@
+package updater
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestSyncMirrorsDetectedIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		patches  []string
+		mirrored string
+	}{
+		// the skipped locked record comes first and keeps its old content
+		{"first record skipped", Config{MultiRecordStrategy: "all", SkipBlocked: true}, []string{"a2", "m"}, "198.51.100.7"},
+		{"debounced", Config{ChangeDebounceCount: 2}, []string{}, "198.51.100.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := homeRecords("198.51.100.1", "198.51.100.1")
+			records[0].Locked = true
+			// the fake api serves the mirror zone as test_zone_name too
+			records = append(records, cloudflare.DNSRecord{ID: "m", Type: "A", Name: "vanity.example.com", Content: "198.51.100.1", TTL: 1})
+			api, server := newFakeAPI(t, records...)
+			test.config.RecordName = "home"
+			test.config.Mirrors = []Mirror{{Zone: test_zone_name, Record: "vanity"}}
+			u := newTestUpdater(t, server, test.config, "198.51.100.7")
+
+			if _, err := u.UpdateOnce(context.Background()); err != nil {
+				t.Fatalf("UpdateOnce() failed: %s", err.Error())
+			}
+			if patches := api.Patches(); strings.Join(patches, ",") != strings.Join(test.patches, ",") {
+				t.Errorf("updated %v, want %v", patches, test.patches)
+			}
+			if mirrored := api.records[2].Content; mirrored != test.mirrored {
+				t.Errorf("mirror is %s, want %s", mirrored, test.mirrored)
+			}
+		})
+	}
+}
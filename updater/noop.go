@@ -0,0 +1,29 @@
+package updater
+
+import (
+	"context"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// isNoop re-reads a record right before it is updated, if DetectNoop is set.
+// If another updater wrote the content since the record was listed, updating
+// it would not change anything, so it is not written. The listed record can
+// not tell, and neither can the record returned by the update, whose
+// modification time is that of the other write either way.
+func (u *Updater) isNoop(ctx context.Context, rc *cloudflare.ResourceContainer, record cloudflare.DNSRecord, content string) (cloudflare.DNSRecord, bool) {
+	if !u.config.DetectNoop {
+		return record, false
+	}
+	current_record, err := u.client().GetDNSRecord(ctx, rc, record.ID)
+	u.breaker.Record(err)
+	if err != nil {
+		u.logger.Warnf("record '%s' could not be read again, updating it anyway: %s\n", record.Name, err.Error())
+		return record, false
+	}
+	if !contentMatches(current_record.Type, current_record.Content, content) {
+		return record, false
+	}
+	u.logger.Infof("record '%s' has been set to %s since it was listed, it was last modified @ %s, not updating it again\n", record.Name, current_record.Content, current_record.ModifiedOn.String())
+	return current_record, true
+}
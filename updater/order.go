@@ -0,0 +1,20 @@
+package updater
+
+import "github.com/cloudflare/cloudflare-go"
+
+// shuffleTargets starts each update of a family one record later than the
+// previous one, so a cycle cut short by the budget or failures does not
+// always starve the same records, see Config.ShuffleRecordOrder.
+func (u *Updater) shuffleTargets(family string, targets []cloudflare.DNSRecord) []cloudflare.DNSRecord {
+	if !u.config.ShuffleRecordOrder || len(targets) < 2 {
+		return targets
+	}
+	u.order_mutex.Lock()
+	offset := u.record_offsets[family] % len(targets)
+	u.record_offsets[family]++
+	u.order_mutex.Unlock()
+
+	shuffled := make([]cloudflare.DNSRecord, 0, len(targets))
+	shuffled = append(shuffled, targets[offset:]...)
+	return append(shuffled, targets[:offset]...)
+}
@@ -0,0 +1,241 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func isAuthorizationError(err error) bool {
+	var authorization_error *cloudflare.AuthorizationError
+	return errors.As(err, &authorization_error)
+}
+
+// verifyToken verifies that the api token of a client is active.
+func verifyToken(ctx context.Context, api *cloudflare.API) error {
+	token, err := api.VerifyAPIToken(ctx)
+	if err != nil {
+		var authentication_error *cloudflare.AuthenticationError
+		if errors.As(err, &authentication_error) || isAuthorizationError(err) {
+			return fmt.Errorf("the api token was rejected by cloudflare, check that it was copied completely: %w", err)
+		}
+		return fmt.Errorf("the api token could not be verified: %w", err)
+	}
+
+	if token.Status != "active" {
+		return fmt.Errorf("the api token is '%s', it has to be active", token.Status)
+	}
+	return nil
+}
+
+// preflight verifies the api token and its permissions with harmless reads,
+// so a missing permission is reported at startup instead of in the first update.
+func (u *Updater) preflight(ctx context.Context) error {
+	if err := verifyToken(ctx, u.client()); err != nil {
+		return err
+	}
+
+	if u.zone_id != "" {
+		return u.preflightZoneID(ctx)
+	}
+
+	zones, err := u.lookupZones(ctx)
+	if err != nil && isOutage(err) && u.config.CachedZoneID != "" {
+		u.logger.Warnf("zone '%s' could not be looked up, falling back to its cached id '%s': %s\n", u.config.ZoneName, u.config.CachedZoneID, err.Error())
+		u.zone_id = u.config.CachedZoneID
+		u.looked_up_zone_id = u.config.CachedZoneID
+		return u.preflightRecords(ctx, cloudflare.ZoneIdentifier(u.zone_id))
+	}
+	if err != nil {
+		if isAuthorizationError(err) {
+			return fmt.Errorf("the api token is missing the 'Zone:Read' permission for zone '%s'", u.config.ZoneName)
+		}
+		return fmt.Errorf("could not list zones: %w", err)
+	}
+
+	if len(zones) < 1 {
+		if u.config.AccountID != "" {
+			return fmt.Errorf("no zones found for '%s' in account '%s', either it does not exist there or the api token is missing the 'Zone:Read' permission for it", u.config.ZoneName, u.config.AccountID)
+		}
+		if near_matches := u.nearZones(ctx); len(near_matches) > 0 {
+			return fmt.Errorf("no zones found for '%s', did you mean '%s'?", u.config.ZoneName, strings.Join(near_matches, "' or '"))
+		}
+		return fmt.Errorf("no zones found for '%s', either it does not exist or the api token is missing the 'Zone:Read' permission for it", u.config.ZoneName)
+	}
+	if len(zones) > 1 {
+		u.logger.Warnf("zone name '%s' exists in %d accounts, using the one of account '%s', set CLOUDFLARE_ACCOUNT_ID to pin it\n", u.config.ZoneName, len(zones), zones[len(zones)-1].Account.ID)
+	}
+
+	u.looked_up_zone_id = zones[len(zones)-1].ID
+	u.name_servers = zones[len(zones)-1].NameServers
+	if zones[len(zones)-1].Paused {
+		u.logger.Warnf("zone '%s' is paused, updates of its records may fail\n", u.config.ZoneName)
+	}
+
+	return u.preflightRecords(ctx, cloudflare.ZoneIdentifier(zones[len(zones)-1].ID))
+}
+
+// lookupZones lists the zones of the configured name, retrying api outages
+// ZoneLookupRetries times.
+func (u *Updater) lookupZones(ctx context.Context) ([]cloudflare.Zone, error) {
+	for attempt := 0; ; attempt++ {
+		zones, err := u.listZones(ctx, u.config.ZoneName)
+		if err == nil || attempt >= u.config.ZoneLookupRetries || !isOutage(err) {
+			return zones, err
+		}
+		delay := u.config.ZoneLookupRetryDelay << attempt
+		u.logger.Warnf("zone '%s' could not be looked up, retrying in %s (%d/%d): %s\n", u.config.ZoneName, delay.String(), attempt+1, u.config.ZoneLookupRetries, err.Error())
+		if err := u.clock.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ZoneID returns the id of the zone, as given or as looked up at startup.
+func (u *Updater) ZoneID() string {
+	if u.zone_id != "" {
+		return u.zone_id
+	}
+	return u.looked_up_zone_id
+}
+
+// preflightZoneID reads the zone given by its id, which also yields its name.
+func (u *Updater) preflightZoneID(ctx context.Context) error {
+	zone, err := u.client().ZoneDetails(ctx, u.zone_id)
+	if err != nil && isAuthorizationError(err) && u.config.ZoneID != "" {
+		// a token scoped to the records of a single zone may not read the
+		// zone itself, the record permissions are verified below
+		u.logger.Infof("api token can not read zone '%s' itself, only verifying its record permissions\n", u.zone_id)
+		if u.config.ZoneName == "" {
+			u.config.ZoneName = u.zone_id
+		}
+		return u.preflightRecords(ctx, cloudflare.ZoneIdentifier(u.zone_id))
+	}
+	if err != nil {
+		var not_found_error *cloudflare.NotFoundError
+		if isAuthorizationError(err) || errors.As(err, &not_found_error) {
+			return fmt.Errorf("zone id '%s' does not exist or the api token is missing the 'Zone:Read' permission for it", u.zone_id)
+		}
+		return fmt.Errorf("could not read zone '%s': %w", u.zone_id, err)
+	}
+
+	u.logger.Infof("zone id '%s' is the zone '%s'\n", u.zone_id, zone.Name)
+	u.zone_paused.Store(zone.Paused)
+	u.name_servers = zone.NameServers
+	if zone.Paused {
+		u.logger.Warnf("zone '%s' is paused, updates of its records may fail\n", zone.Name)
+	}
+	u.config.ZoneName = zone.Name
+	qualifyRecordNames(&u.config)
+	return u.preflightRecords(ctx, cloudflare.ZoneIdentifier(u.zone_id))
+}
+
+func (u *Updater) preflightRecords(ctx context.Context, rc *cloudflare.ResourceContainer) error {
+	if u.config.LookupStrategy == LookupID {
+		record, err := u.client().GetDNSRecord(ctx, rc, u.config.RecordID)
+		if err != nil {
+			if isAuthorizationError(err) {
+				return fmt.Errorf("the api token is missing the 'DNS:Read' permission for zone '%s'", u.config.ZoneName)
+			}
+			return fmt.Errorf("could not read record '%s': %w", u.config.RecordID, err)
+		}
+		u.logger.Infof("record id '%s' is the %s record '%s'\n", u.config.RecordID, record.Type, record.Name)
+		if u.config.RecordName == "" {
+			u.config.RecordName = record.Name
+		}
+		return u.checkRecords([]cloudflare.DNSRecord{record})
+	}
+
+	records, _, err := u.client().ListDNSRecords(ctx, rc, u.recordsParams(""))
+	var request_error *cloudflare.RequestError
+	if err == nil && len(records) < 1 || errors.As(err, &request_error) {
+		if qualified := u.qualifyLiteralName(ctx, rc); qualified != nil {
+			records, err = qualified, nil
+		}
+	}
+	if err != nil {
+		if isAuthorizationError(err) {
+			return fmt.Errorf("the api token is missing the 'DNS:Read' permission for zone '%s'", u.config.ZoneName)
+		}
+		return fmt.Errorf("could not list records for '%s': %w", u.config.RecordName, err)
+	}
+
+	return u.checkRecords(records)
+}
+
+// qualifyLiteralName retries the lookup of a literal record name, that found
+// no records or was rejected, with the name qualified by the zone. If that
+// finds the records the qualified name is used from now on.
+func (u *Updater) qualifyLiteralName(ctx context.Context, rc *cloudflare.ResourceContainer) []cloudflare.DNSRecord {
+	if !u.config.LiteralRecordName || u.config.RecordComment != "" || u.config.RecordName == "" {
+		return nil
+	}
+	qualified := qualifyRecordName(u.config.RecordName, u.config.ZoneName, cloudflare.SilentLeveledLogger)
+	if qualified == u.config.RecordName {
+		return nil
+	}
+	records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Name: qualified})
+	if err != nil || len(records) < 1 {
+		return nil
+	}
+	u.logger.Warnf("record name '%s' is not fully qualified and found no records, but '%s' did, using it instead\n", u.config.RecordName, qualified)
+	u.config.RecordName = qualified
+	return records
+}
+
+// checkRecords warns about settings of the managed records that are likely
+// unintended.
+func (u *Updater) checkRecords(records []cloudflare.DNSRecord) error {
+	u.logger.Infof("api token is active and can read records of zone '%s'\n", u.config.ZoneName)
+
+	// a proxied record resolves to cloudflare, not to the updated ip
+	for _, record := range records {
+		if record.Proxied != nil && *record.Proxied && !u.config.ExpectProxied {
+			u.logger.Warnf("record '%s' is proxied through cloudflare, connections to it will not reach the updated ip directly, set CLOUDFLARE_PROXIED=true if that is intended\n", record.Name)
+		}
+	}
+	return nil
+}
+
+// nearZones lists the zones the token can read whose name is close to the
+// configured one, e.g. the zone of a record name given as zone name or a typo.
+func (u *Updater) nearZones(ctx context.Context) []string {
+	zones, err := u.client().ListZones(ctx)
+	if err != nil {
+		return nil
+	}
+
+	wanted := strings.ToLower(strings.TrimSuffix(u.config.ZoneName, "."))
+	near_matches := []string{}
+	for _, zone := range zones {
+		name := strings.ToLower(zone.Name)
+		if strings.HasSuffix(wanted, "."+name) || strings.HasSuffix(name, "."+wanted) || editDistance(wanted, name) <= 2 {
+			near_matches = append(near_matches, zone.Name)
+		}
+	}
+	return near_matches
+}
+
+// editDistance is the levenshtein distance of two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
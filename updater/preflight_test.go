@@ -0,0 +1,69 @@
+package updater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+func TestQualifyLiteralName(t *testing.T) {
+	tests := []struct {
+		name      string
+		rejected  bool
+		exists    bool
+		qualified bool
+	}{
+		{"rejected and found qualified", true, true, true},
+		{"not found and found qualified", false, true, true},
+		{"not found either way", false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := []cloudflare.DNSRecord{}
+			if test.exists {
+				records = append(records, cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 1})
+			}
+			api, server := newFakeAPI(t, records...)
+			api.reject_unqualified = test.rejected
+			logger := &testLogger{}
+			u := newTestUpdater(t, server, Config{RecordName: "home", LiteralRecordName: true, Logger: logger}, "198.51.100.7")
+
+			want := "home"
+			if test.qualified {
+				want = "home.example.com"
+			}
+			if u.config.RecordName != want {
+				t.Errorf("record name is '%s', want '%s'", u.config.RecordName, want)
+			}
+			if logged := logger.Logged("is not fully qualified"); logged != test.qualified {
+				t.Errorf("qualifying the name was logged: %t, want %t", logged, test.qualified)
+			}
+			if !test.qualified {
+				return
+			}
+			if _, err := u.UpdateOnce(context.Background()); err != nil {
+				t.Fatalf("UpdateOnce() failed: %s", err.Error())
+			}
+			if patches := api.Patches(); len(patches) != 1 || patches[0] != "a" {
+				t.Errorf("updated %v, want [a]", patches)
+			}
+		})
+	}
+}
+
+func TestQualifyLiteralNameRejected(t *testing.T) {
+	api, server := newFakeAPI(t)
+	api.reject_unqualified = true
+	_, err := New(Config{
+		APIToken:          "token",
+		ZoneName:          test_zone_name,
+		RecordName:        "home",
+		LiteralRecordName: true,
+		APIOptions:        []cloudflare.Option{cloudflare.BaseURL(server.URL), cloudflare.UsingRateLimit(1000)},
+		CurrentIP:         func() (string, error) { return "198.51.100.7", nil },
+	})
+	if err == nil {
+		t.Errorf("New() succeeded, the name was rejected and its qualified form found no records")
+	}
+}
@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// ReportEntry compares one managed record with the content it should have.
+type ReportEntry struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Live    string `json:"live"`
+	Desired string `json:"desired"`
+	InSync  bool   `json:"in_sync"`
+}
+
+// Report lists every managed record and whether it is in sync, see Reconcile.
+type Report struct {
+	CheckedAt time.Time     `json:"checked_at"`
+	Entries   []ReportEntry `json:"entries"`
+	Errors    []string      `json:"errors,omitempty"`
+}
+
+// InSync reports whether every record was checked and is in sync.
+func (r Report) InSync() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+	for _, entry := range r.Entries {
+		if !entry.InSync {
+			return false
+		}
+	}
+	return true
+}
+
+// Reconcile compares the managed records with the detected ip of every
+// configured ip family, without changing anything.
+func (u *Updater) Reconcile(ctx context.Context) (Report, error) {
+	report := Report{CheckedAt: u.clock.Now(), Entries: []ReportEntry{}}
+
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	if u.config.CNAMETarget != "" {
+		if err := u.reconcileCNAME(ctx, rc, u.config.RecordName, u.config.CNAMETarget, &report); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		return report, nil
+	}
+
+	for _, family := range u.config.Families {
+		if err := u.reconcileFamily(ctx, rc, family, &report); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	if u.config.WWWCNAME {
+		if err := u.reconcileCNAME(ctx, rc, "www."+u.config.RecordName, u.config.RecordName, &report); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	return report, nil
+}
+
+func (u *Updater) reconcileFamily(ctx context.Context, rc *cloudflare.ResourceContainer, family string, report *Report) error {
+	current_ip, err := u.detectIP(ctx, family)
+	if err != nil {
+		return fmt.Errorf("current IP address could not be determined from any endpoint: %w", err)
+	}
+
+	record_type := recordTypeForFamily(family)
+	if family == "" {
+		record_type = recordTypeForIP(current_ip)
+	}
+
+	// skipped duplicates are reported all the same
+	targets, err := u.managedRecords(ctx, rc, record_type)
+	if err != nil && !errors.Is(err, errDuplicatesSkipped) {
+		return err
+	}
+
+	for _, record := range targets {
+		report.Entries = append(report.Entries, ReportEntry{
+			Name:    record.Name,
+			Type:    record.Type,
+			Live:    record.Content,
+			Desired: current_ip.String(),
+			InSync:  contentMatches(record.Type, record.Content, current_ip.String()) && len(u.withSettings(record, &cloudflare.UpdateDNSRecordParams{}, false)) < 1,
+		})
+	}
+	return nil
+}
+
+func (u *Updater) reconcileCNAME(ctx context.Context, rc *cloudflare.ResourceContainer, name string, target string, report *Report) error {
+	records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+		Type: "CNAME",
+		Name: name,
+	})
+	u.breaker.Record(err)
+	if err != nil {
+		return fmt.Errorf("could not list records for '%s': %w", name, err)
+	}
+
+	entry := ReportEntry{Name: name, Type: "CNAME", Desired: target}
+	if len(records) > 0 {
+		entry.Live = records[len(records)-1].Content
+		entry.InSync = contentMatches("CNAME", entry.Live, target)
+	}
+	// a missing CNAME is reported with empty live content
+	report.Entries = append(report.Entries, entry)
+	return nil
+}
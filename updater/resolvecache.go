@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// resolveCache caches the addresses of the endpoint hostnames for a fixed ttl,
+// saving the lookups of short intervals.
+type resolveCache struct {
+	ttl     time.Duration
+	clock   Clock
+	mutex   sync.Mutex
+	entries map[string]resolveCacheEntry
+}
+
+type resolveCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+func newResolveCache(ttl time.Duration, clock Clock) *resolveCache {
+	return &resolveCache{ttl: ttl, clock: clock, entries: map[string]resolveCacheEntry{}}
+}
+
+// ipNetworkForNetwork maps a dial network onto a lookup network.
+func ipNetworkForNetwork(network string) string {
+	switch network {
+	case "tcp4":
+		return "ip4"
+	case "tcp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+func (c *resolveCache) lookup(ctx context.Context, network string, host string) ([]net.IP, error) {
+	key := network + "/" + host
+	c.mutex.Lock()
+	entry, exists := c.entries[key]
+	c.mutex.Unlock()
+	if exists && c.clock.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, ipNetworkForNetwork(network), host)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.entries[key] = resolveCacheEntry{ips: ips, expires: c.clock.Now().Add(c.ttl)}
+	c.mutex.Unlock()
+	return ips, nil
+}
+
+func (c *resolveCache) forget(network string, host string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, network+"/"+host)
+}
+
+// dial dials a cached address of the host, falling back to a normal dial if
+// none of them works, e.g. because the endpoint moved.
+func (c *resolveCache) dial(ctx context.Context, dialer *net.Dialer, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	if ips, err := c.lookup(ctx, network, host); err == nil {
+		for _, ip := range ips {
+			if conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, nil
+			}
+		}
+		c.forget(network, host)
+	}
+	return dialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,46 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// restoreRecords creates the record and its aliases if they are missing, but
+// never touches existing records, whatever their content.
+func (u *Updater) restoreRecords(ctx context.Context, rc *cloudflare.ResourceContainer, record_type string, current_ip net.IP, check *Check) error {
+	errs := []error{}
+	for _, name := range append([]string{u.config.RecordName}, u.config.RecordAliases...) {
+		records, _, err := u.client().ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{Type: record_type, Name: name})
+		u.breaker.Record(err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not list records for '%s': %w", name, err))
+			continue
+		}
+
+		if len(records) > 0 {
+			record := records[len(records)-1]
+			u.logger.Infof("record '%s' exists with content %s, restore-only mode never overwrites it\n", name, record.Content)
+			check.Records = append(check.Records, RecordResult{Name: name, Action: "unchanged", Content: record.Content})
+			continue
+		}
+
+		u.logger.Warnf("record '%s' is missing\n", name)
+		if !u.inUpdateWindow(name) {
+			check.Records = append(check.Records, RecordResult{Name: name, Action: "outside_window"})
+			continue
+		}
+		u.logger.Infof("restoring record '%s' with %s...\n", name, current_ip.String())
+		if _, err := u.createRecord(ctx, rc, record_type, name, current_ip); err != nil {
+			check.Records = append(check.Records, RecordResult{Name: name, Action: "failed"})
+			errs = append(errs, err)
+			continue
+		}
+		u.logger.Infof("record '%s' has been restored\n", name)
+		check.Records = append(check.Records, RecordResult{Name: name, Action: "created", Content: current_ip.String()})
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"errors"
+	"time"
+)
+
+// RecordResult is what an update did to a single record.
+type RecordResult struct {
+	Name            string `json:"name"`
+	Action          string `json:"action"`
+	Content         string `json:"content"`
+	PreviousContent string `json:"previous_content,omitempty"`
+}
+
+// Check is the outcome of updating the records of one record type.
+type Check struct {
+	RecordType string
+	// IP is the detected ip, empty if it could not be detected
+	IP       string
+	Records  []RecordResult
+	Duration time.Duration
+	Err      error
+}
+
+// Actions counts the records of the check by their action, e.g. "updated".
+func (c Check) Actions() map[string]int {
+	actions := map[string]int{}
+	for _, record := range c.Records {
+		actions[record.Action]++
+	}
+	return actions
+}
+
+// Result is the outcome of an update, with one Check per ip family. It holds
+// everything the updater logs, so embedders can do their own logging and
+// metrics with a silent logger.
+type Result struct {
+	CheckedAt time.Time
+	Duration  time.Duration
+	Checks    []Check
+}
+
+// Err joins the errors of all checks, nil if every check succeeded.
+func (r Result) Err() error {
+	errs := []error{}
+	for _, check := range r.Checks {
+		errs = append(errs, check.Err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// withSettings adds the settings of a record that drifted from the desired
+// ones to params and describes them, if reconciling settings is enabled or the
+// record is reconciled at startup.
+func (u *Updater) withSettings(record cloudflare.DNSRecord, params *cloudflare.UpdateDNSRecordParams, reconciling bool) []string {
+	if !u.config.ReconcileSettings && !reconciling {
+		return nil
+	}
+
+	drift := []string{}
+	proxied := u.config.ExpectProxied
+	if record.Proxied == nil || *record.Proxied != proxied {
+		params.Proxied = &proxied
+		drift = append(drift, fmt.Sprintf("proxied is %t instead of %t", !proxied, proxied))
+	}
+	// proxied records always have an automatic ttl, a ttl lowered by
+	// ADAPTIVE_TTL is restored separately
+	u.ttl_mutex.Lock()
+	_, lowered := u.restore_ttls[record.ID]
+	u.ttl_mutex.Unlock()
+	if !proxied && u.config.RecordTTL > 0 && params.TTL == 0 && !lowered && record.TTL != u.config.RecordTTL {
+		params.TTL = u.config.RecordTTL
+		drift = append(drift, fmt.Sprintf("ttl is %d instead of %d", record.TTL, u.config.RecordTTL))
+	}
+	if comment := u.desiredComment(record); comment != "" && record.Comment != comment {
+		params.Comment = &comment
+		drift = append(drift, fmt.Sprintf("comment is '%s' instead of '%s'", record.Comment, comment))
+	}
+	return drift
+}
+
+// reconcileSettings updates the drifted settings of a record whose content is
+// up-to-date. At startup the write is not suppressed by RespectTTL.
+func (u *Updater) reconcileSettings(ctx context.Context, rc *cloudflare.ResourceContainer, record cloudflare.DNSRecord, reconciling bool, check *Check) (bool, error) {
+	params := cloudflare.UpdateDNSRecordParams{ID: record.ID}
+	drift := u.withSettings(record, &params, reconciling)
+	if len(drift) < 1 {
+		return false, nil
+	}
+	u.logger.Infof("settings of '%s' have drifted (%s)\n", record.Name, strings.Join(drift, ", "))
+	if !u.inUpdateWindow(record.Name) {
+		check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "outside_window", Content: record.Content})
+		return true, nil
+	}
+	if !reconciling && u.suppressWrite(record, record.Content) {
+		check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "suppressed", Content: record.Content})
+		return true, nil
+	}
+
+	u.logger.Infof("updating the settings of '%s'...\n", record.Name)
+	updated_record, err := u.client().UpdateDNSRecord(ctx, rc, params)
+	u.breaker.Record(err)
+	if err != nil {
+		check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "failed", Content: record.Content})
+		return true, fmt.Errorf("could not reconcile the settings of record '%s' in zone '%s': %w", record.Name, u.config.ZoneName, err)
+	}
+	u.logChange(fmt.Sprintf("record '%s' has been successfully reconciled", record.Name), record, updated_record)
+	u.recordWrite(updated_record)
+	check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "reconciled", Content: updated_record.Content})
+	return true, nil
+}
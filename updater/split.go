@@ -0,0 +1,24 @@
+package updater
+
+import "strings"
+
+// SplitList splits a comma separated list, a comma escaped as "\," is part of
+// the entry, e.g. `a\,b,c` is "a,b" and "c". "\\" is a literal backslash,
+// other backslashes are kept as they are.
+func SplitList(list string) []string {
+	entries := []string{}
+	var entry strings.Builder
+	for i := 0; i < len(list); i++ {
+		switch {
+		case list[i] == '\\' && i+1 < len(list) && (list[i+1] == ',' || list[i+1] == '\\'):
+			i++
+			entry.WriteByte(list[i])
+		case list[i] == ',':
+			entries = append(entries, entry.String())
+			entry.Reset()
+		default:
+			entry.WriteByte(list[i])
+		}
+	}
+	return append(entries, entry.String())
+}
@@ -0,0 +1,45 @@
+package updater
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		list    string
+		entries []string
+	}{
+		{"", []string{""}},
+		{"a", []string{"a"}},
+		{"a,b,c", []string{"a", "b", "c"}},
+		{"a,,b", []string{"a", "", "b"}},
+		{`a\,b,c`, []string{"a,b", "c"}},
+		{`a\,b\,c`, []string{"a,b,c"}},
+		{`v=spf1 a\, mx`, []string{"v=spf1 a, mx"}},
+		{`a\\,b`, []string{`a\`, "b"}},
+		{`a\\\,b`, []string{`a\,b`}},
+		{`a\b,c`, []string{`a\b`, "c"}},
+		{`a,b\`, []string{"a", `b\`}},
+	}
+	for _, test := range tests {
+		entries := SplitList(test.list)
+		if strings.Join(entries, "|") != strings.Join(test.entries, "|") || len(entries) != len(test.entries) {
+			t.Errorf("SplitList(`%s`) = %q, want %q", test.list, entries, test.entries)
+		}
+	}
+}
+
+func TestParseIPNetsEscaped(t *testing.T) {
+	// an escaped comma does not split the entry, which is then no address
+	if _, err := ParseIPNets(`192.0.2.1\,192.0.2.2`); err == nil {
+		t.Errorf("ParseIPNets() of an escaped comma succeeded")
+	}
+	nets, err := ParseIPNets("192.0.2.1, 2001:db8::/32,")
+	if err != nil {
+		t.Fatalf("ParseIPNets() failed: %s", err.Error())
+	}
+	if len(nets) != 2 || nets[0].String() != "192.0.2.1/32" || nets[1].String() != "2001:db8::/32" {
+		t.Errorf("ParseIPNets() = %v, want [192.0.2.1/32 2001:db8::/32]", nets)
+	}
+}
@@ -0,0 +1,27 @@
+package updater
+
+import "sync/atomic"
+
+// startReconciling reports whether the startup reconcile of a family is still
+// pending, see Config.ReconcileOnStart.
+func (u *Updater) startReconciling(family string) bool {
+	pending, exists := u.start_reconciles[family]
+	return exists && pending.Load()
+}
+
+// finishStartReconcile ends the startup reconcile of a family after its first
+// successful update, from then on changes are detected as usual.
+func (u *Updater) finishStartReconcile(family string) {
+	if pending, exists := u.start_reconciles[family]; exists && pending.Swap(false) {
+		u.logger.Infof("startup reconcile finished, only applying changes from now on\n")
+	}
+}
+
+func newStartReconciles(families []string) map[string]*atomic.Bool {
+	start_reconciles := map[string]*atomic.Bool{}
+	for _, family := range families {
+		start_reconciles[family] = &atomic.Bool{}
+		start_reconciles[family].Store(true)
+	}
+	return start_reconciles
+}
@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReconcileOnStartSettings(t *testing.T) {
+	proxied := false
+	record := homeRecords("198.51.100.7")[0]
+	record.Proxied = &proxied
+	api, server := newFakeAPI(t, record)
+	u := newTestUpdater(t, server, Config{RecordName: "home", ReconcileOnStart: true, RecordTTL: 300, RespectTTL: true}, "198.51.100.7")
+
+	result, err := u.UpdateOnce(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateOnce() failed: %s", err.Error())
+	}
+	if got := actions(result.Checks[0]); len(got) != 1 || got[0] != "home.example.com:reconciled" {
+		t.Errorf("actions of the startup reconcile are %v, want [home.example.com:reconciled]", got)
+	}
+	if patches := api.Patches(); len(patches) != 1 || api.records[0].TTL != 300 {
+		t.Errorf("patches are %v with ttl %d, want the ttl of a1 reconciled to 300", patches, api.records[0].TTL)
+	}
+
+	// once started only changed content is applied, ReconcileSettings is off
+	api.mutex.Lock()
+	api.records[0].TTL = 1
+	api.mutex.Unlock()
+	result, err = u.UpdateOnce(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateOnce() failed: %s", err.Error())
+	}
+	if got := actions(result.Checks[0]); len(got) != 1 || got[0] != "home.example.com:unchanged" {
+		t.Errorf("actions after the startup reconcile are %v, want [home.example.com:unchanged]", got)
+	}
+	if patches := api.Patches(); len(patches) != 1 {
+		t.Errorf("patches are %v, the drifted ttl was reconciled after startup", patches)
+	}
+}
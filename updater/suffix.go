@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// HostSuffix is the host part of an IPv6 address, combined with the prefix of
+// the detected address so the record points at a host behind a delegated
+// prefix that changes.
+type HostSuffix struct {
+	IP           net.IP
+	PrefixLength int
+}
+
+// ParseHostSuffix parses "::1234:5678:9abc:def0", optionally followed by the
+// length of the prefix it is combined with, e.g. "::1/56". The prefix length
+// defaults to 64.
+func ParseHostSuffix(suffix_string string) (*HostSuffix, error) {
+	ip_string, length_string, has_length := strings.Cut(suffix_string, "/")
+	suffix := &HostSuffix{IP: net.ParseIP(ip_string), PrefixLength: 64}
+	if suffix.IP == nil || suffix.IP.To4() != nil {
+		return nil, fmt.Errorf("'%s' is not an IPv6 address", ip_string)
+	}
+	if has_length {
+		length, err := strconv.Atoi(length_string)
+		if err != nil || length < 1 || length > 127 {
+			return nil, fmt.Errorf("prefix length '%s' is not between 1 and 127", length_string)
+		}
+		suffix.PrefixLength = length
+	}
+	if !suffix.IP.Mask(net.CIDRMask(suffix.PrefixLength, 8*net.IPv6len)).IsUnspecified() {
+		return nil, fmt.Errorf("'%s' has bits set within the /%d prefix", ip_string, suffix.PrefixLength)
+	}
+	return suffix, nil
+}
+
+func (s *HostSuffix) String() string {
+	return fmt.Sprintf("%s/%d", s.IP.String(), s.PrefixLength)
+}
+
+// Apply returns the prefix of ip with the host part of the suffix.
+func (s *HostSuffix) Apply(ip net.IP) net.IP {
+	mask := net.CIDRMask(s.PrefixLength, 8*net.IPv6len)
+	prefix, host := ip.To16().Mask(mask), s.IP.To16()
+	combined := make(net.IP, net.IPv6len)
+	for i := range combined {
+		combined[i] = prefix[i] | host[i]&^mask[i]
+	}
+	return combined
+}
@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// auto_ttl_seconds is what cloudflare's automatic ttl of 1 amounts to
+const auto_ttl_seconds = 300
+
+// lastWrite is the last content written to a record by this updater.
+type lastWrite struct {
+	at      time.Time
+	content string
+}
+
+// suppressWrite reports whether writing a record again is suppressed because
+// the last write is more recent than the record's ttl and content is what was
+// written then, see Config.RespectTTL.
+func (u *Updater) suppressWrite(record cloudflare.DNSRecord, content string) bool {
+	if !u.config.RespectTTL {
+		return false
+	}
+
+	u.write_mutex.Lock()
+	last, exists := u.last_writes[record.ID]
+	u.write_mutex.Unlock()
+	if !exists || !contentMatches(record.Type, last.content, content) {
+		return false
+	}
+
+	ttl := time.Duration(record.TTL) * time.Second
+	if record.TTL == 1 {
+		ttl = auto_ttl_seconds * time.Second
+	}
+	since := u.clock.Now().Sub(last.at)
+	if since >= ttl {
+		return false
+	}
+	u.logger.Infof("'%s' was last written %s ago with %s, within its ttl of %s, suppressing the write\n", record.Name, since.Round(time.Second).String(), content, ttl.String())
+	return true
+}
+
+// recordWrite remembers a write for suppressWrite.
+func (u *Updater) recordWrite(record cloudflare.DNSRecord) {
+	if !u.config.RespectTTL {
+		return
+	}
+	u.write_mutex.Lock()
+	defer u.write_mutex.Unlock()
+	u.last_writes[record.ID] = lastWrite{at: u.clock.Now(), content: record.Content}
+}
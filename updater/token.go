@@ -0,0 +1,33 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// client returns the current cloudflare api client.
+func (u *Updater) client() *cloudflare.API {
+	u.api_mutex.RLock()
+	defer u.api_mutex.RUnlock()
+	return u.api
+}
+
+// SetAPIToken replaces the api client with one using token, e.g. after the
+// token was rotated. The token is verified first, if that fails the current
+// client is kept.
+func (u *Updater) SetAPIToken(ctx context.Context, token string) error {
+	api, err := cloudflare.NewWithAPIToken(token, u.config.APIOptions...)
+	if err != nil {
+		return fmt.Errorf("could not create cloudflare api client with the provided token, %w", err)
+	}
+	if err := verifyToken(ctx, api); err != nil {
+		return err
+	}
+
+	u.api_mutex.Lock()
+	defer u.api_mutex.Unlock()
+	u.api = api
+	return nil
+}
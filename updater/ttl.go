@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// adaptive_ttl is the ttl of a record right after its content changed, the
+// lowest ttl cloudflare allows on every plan
+const adaptive_ttl = 60
+
+// lowerTTL returns the ttl to write along with changed content, remembering the
+// ttl to restore once the content is stable again. 0 keeps the current ttl.
+func (u *Updater) lowerTTL(record cloudflare.DNSRecord) int {
+	// proxied records always have an automatic ttl
+	if !u.config.AdaptiveTTL || record.Proxied != nil && *record.Proxied {
+		return 0
+	}
+
+	u.ttl_mutex.Lock()
+	defer u.ttl_mutex.Unlock()
+	if _, exists := u.restore_ttls[record.ID]; !exists && record.TTL != adaptive_ttl {
+		u.restore_ttls[record.ID] = record.TTL
+	}
+	return adaptive_ttl
+}
+
+// restoreTTL restores the ttl of a record lowered by lowerTTL, once the record
+// has been found up-to-date in a following update.
+func (u *Updater) restoreTTL(ctx context.Context, rc *cloudflare.ResourceContainer, record cloudflare.DNSRecord) error {
+	u.ttl_mutex.Lock()
+	ttl, exists := u.restore_ttls[record.ID]
+	u.ttl_mutex.Unlock()
+	if !exists || !u.inUpdateWindow(record.Name) {
+		return nil
+	}
+
+	u.logger.Infof("content of '%s' is stable, restoring its ttl to %d\n", record.Name, ttl)
+	_, err := u.client().UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{
+		ID:  record.ID,
+		TTL: ttl,
+	})
+	u.breaker.Record(err)
+	if err != nil {
+		return fmt.Errorf("could not restore the ttl of record '%s': %w", record.Name, err)
+	}
+
+	u.ttl_mutex.Lock()
+	delete(u.restore_ttls, record.ID)
+	u.ttl_mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,1241 @@
+// Package updater keeps Cloudflare DNS records pointed at the current public
+// ip address. It is the core of the cloudflare-ddns binary and can be embedded
+// into other programs.
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// Config is the configuration of an Updater. Only APIToken, ZoneName and
+// either RecordName or RecordComment are required.
+type Config struct {
+	APIToken   string
+	APIOptions []cloudflare.Option
+
+	ZoneName string
+	// ZoneID selects the zone by its id instead, without listing zones. This
+	// works with tokens that are not allowed to list zones.
+	ZoneID string
+	// AccountID restricts the zone lookup to this account, for zone names
+	// that exist in several accounts.
+	AccountID string
+	// RecordName selects the record to update by its name.
+	RecordName string
+	// LookupStrategy is how the current content of the records is
+	// determined, LookupList (default), LookupResolve or LookupID, see there.
+	LookupStrategy string
+	// MultiRecordStrategy picks the records to update if several records of
+	// the type have RecordName, "last" (default), "first", "all", "error" or
+	// "skip", which leaves them all as they are.
+	MultiRecordStrategy string
+	// RecordID selects a single record by its id instead, see LookupID.
+	RecordID string
+	// LiteralRecordName uses RecordName and RecordAliases as given, instead
+	// of appending the zone name to names outside of the zone.
+	LiteralRecordName bool
+	// RecordComment selects all records carrying this comment instead.
+	RecordComment string
+
+	// Endpoints return the public ip of the caller, defaults to icanhazip.com.
+	Endpoints []IPEndpoint
+	// IgnoreIPs are placeholder addresses, e.g. of a reflector's cdn, that
+	// are treated as a failure of the endpoint returning them.
+	IgnoreIPs []*net.IPNet
+	// ResolveHostname, if set, takes the ip from resolving this hostname
+	// instead of asking the endpoints.
+	ResolveHostname string
+	// Families lists the ip families to maintain records for, "4" (A),
+	// "6" (AAAA) or "" (ip of any family, A or AAAA record depending on the
+	// detected address). Defaults to "".
+	Families []string
+	// RecordType, "A" or "AAAA", overrides inferring the record type from the
+	// detected address and restricts detection to the matching family.
+	RecordType string
+
+	// Interval is the time between updates, defaults to 5 minutes.
+	Interval time.Duration
+	// Intervals overrides the interval per ip family.
+	Intervals map[string]time.Duration
+
+	// ResolveCacheTTL caches the addresses of the endpoint hostnames this
+	// long, 0 resolves them on every request.
+	ResolveCacheTTL time.Duration
+	// StrictTLS fails the update on an endpoint certificate that can not be
+	// verified, instead of falling back to the next endpoint.
+	StrictTLS bool
+	// IPMaxRedirects caps the redirects followed per endpoint request, 0 uses
+	// the default of 5 and a negative value follows no redirects at all.
+	IPMaxRedirects int
+
+	// SkipProbe skips requesting the endpoints once in New.
+	SkipProbe bool
+	// SkipCGNAT skips updating records to carrier-grade NAT addresses.
+	SkipCGNAT bool
+	// CreateMissing creates the record and its aliases with the detected ip if
+	// they are missing, by record type ("A" or "AAAA"). A type that is not
+	// enabled fails the update of a missing record instead.
+	CreateMissing map[string]bool
+	// RestoreOnly only creates the records if they are missing, but never
+	// updates existing ones, as a safety net behind manual dns management.
+	RestoreOnly bool
+	// CNAMETarget maintains RecordName as a CNAME pointing at this hostname
+	// instead of an A or AAAA record pointing at the detected ip.
+	CNAMETarget string
+	// ExpectProxied confirms that proxied records are intended, New warns
+	// about them otherwise.
+	ExpectProxied bool
+	// WWWCNAME maintains www.<RecordName> as a CNAME pointing at RecordName.
+	WWWCNAME bool
+	// CircuitBreakerThreshold opens the circuit breaker around the cloudflare
+	// api after this many consecutive failed calls, 0 disables it.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long the circuit stays open, defaults to
+	// 1 minute.
+	CircuitBreakerCooldown time.Duration
+	// OnCircuitStateChange, if set, is called with the new circuit state.
+	OnCircuitStateChange func(state string)
+
+	// IPMaxRetries retries detecting the ip this many times, IPRetryDelay
+	// apart (default 1 second).
+	IPMaxRetries int
+	IPRetryDelay time.Duration
+	// APIMaxRetries retries updating the records this many times on api
+	// outages, with an exponential backoff starting at APIRetryDelay (default
+	// 10 seconds). This is on top of the retries of the cloudflare-go client.
+	APIMaxRetries int
+	APIRetryDelay time.Duration
+	// ZoneLookupRetries retries looking up the zone at startup this many
+	// times on api outages, with an exponential backoff starting at
+	// ZoneLookupRetryDelay (default 1s). If it still fails, the zone falls
+	// back to CachedZoneID if set, e.g. the id of the last run.
+	ZoneLookupRetries    int
+	ZoneLookupRetryDelay time.Duration
+	CachedZoneID         string
+
+	// RecordAliases are updated together with RecordName as one group, e.g.
+	// the documented aliases of a mail server's primary record.
+	RecordAliases []string
+	// Mirrors are records in other zones kept at the content of the managed
+	// records, see Mirror.
+	Mirrors []Mirror
+	// ZoneConcurrency bounds how many zones are worked on at once, 0 or 1
+	// works on one zone after the other. The zones of the mirrors are
+	// independent of each other, but they all copy the content of the
+	// managed records, so they are synced once the managed zone is done.
+	ZoneConcurrency int
+	// CycleBudget caps the time of one update including all endpoint
+	// fallbacks and retries, 0 does not cap it.
+	CycleBudget time.Duration
+	// UpdateWindow, if set, restricts writing records to the window, outside
+	// of it changes are only logged.
+	UpdateWindow *UpdateWindow
+	// RecordUpdateStagger is waited between updating two records, to spread
+	// the api calls of large record sets.
+	RecordUpdateStagger time.Duration
+
+	// ReconcileSettings also updates records whose settings drifted from the
+	// desired ones, proxied (ExpectProxied), RecordTTL and DesiredComment if
+	// set, not only records whose content changed.
+	ReconcileSettings bool
+	RecordTTL         int
+	DesiredComment    string
+
+	// AdaptiveTTL lowers the ttl of a record to 60 seconds along with a change
+	// of its content and restores the previous ttl once the content was found
+	// up-to-date in a following update.
+	AdaptiveTTL bool
+
+	// RespectTTL suppresses writing a record again while its last write by
+	// this updater is more recent than its ttl, unless the ip changed since.
+	RespectTTL bool
+
+	// InstanceID, if set, is stamped into the comment of every record this
+	// updater writes, so a record recently changed by another instance can
+	// be warned about.
+	InstanceID string
+
+	// AllowMappedIPv6 accepts an IPv4-mapped address like ::ffff:1.2.3.4 for
+	// AAAA records, an endpoint returning one is a failure otherwise. For A
+	// records mapped addresses are always used as the IPv4 address.
+	AllowMappedIPv6 bool
+
+	// SkipBlocked skips records that are locked or can not be updated
+	// because the zone is paused, instead of failing the update, see
+	// ErrRecordLocked and ErrZonePaused.
+	SkipBlocked bool
+
+	// ResolveAuthoritative makes the resolve lookup strategy ask the
+	// nameservers of the zone, read from the api at startup, instead of the
+	// system resolver.
+	ResolveAuthoritative bool
+
+	// BatchLookup lists all records of the zone once per update and matches
+	// the record and its aliases in memory, instead of one list call per
+	// name. Zones of more than 1000 records are still looked up per name.
+	BatchLookup bool
+
+	// Interface, if set, takes the current ip from the addresses of this
+	// network interface instead of asking an endpoint, see interfaceIP.
+	// PreferTemporary prefers temporary IPv6 addresses over stable ones.
+	Interface       string
+	PreferTemporary bool
+
+	// CurrentIP, if set, is called for the current ip on every update instead
+	// of asking an endpoint, e.g. to push an ip detected by another tool.
+	CurrentIP func() (string, error)
+
+	// DetectNoop re-reads a record before updating it, one that another
+	// updater already set to the content is not written and reported as
+	// "noop" instead of "updated", so no change is recorded or published for
+	// it.
+	DetectNoop bool
+
+	// ExpectedGatewayMAC, if set, only updates the records while the default
+	// gateway has this mac address, e.g. on a laptop that is not always at
+	// home. Only supported on linux.
+	ExpectedGatewayMAC net.HardwareAddr
+
+	// ReconcileOnStart applies the desired state to every record on the first
+	// update, asking the api even if the record resolves to the ip, comparing
+	// the settings of ReconcileSettings even if it is not enabled and ignoring
+	// ChangeDebounceCount and RespectTTL, then only changes are applied as
+	// usual.
+	ReconcileOnStart bool
+
+	// ShuffleRecordOrder rotates the record an update starts with, so every
+	// record is updated first in turn.
+	ShuffleRecordOrder bool
+
+	// SkipFamilyMismatch skips updating a record if only addresses of the
+	// other ip family could be detected, e.g. only IPv6 for an A record on a
+	// single-stack network, instead of failing the update.
+	SkipFamilyMismatch bool
+
+	// HALock, if set, is a TXT record of the zone used as a lock between
+	// replicas, only the instance holding it updates the records while the
+	// others stand by, see holdLock. Requires InstanceID.
+	HALock string
+
+	// IPv6HostSuffix, if set, replaces the host part of a detected IPv6
+	// address, only its prefix is used.
+	IPv6HostSuffix *HostSuffix
+
+	// IPCacheTTL reuses the ip fetched from an endpoint for this long, the
+	// records are still compared with it on every update. This spares the
+	// endpoints at short intervals, but delays noticing a changed ip by up
+	// to the ttl.
+	IPCacheTTL time.Duration
+
+	// ChangeDebounceCount only applies a changed ip once it has been detected
+	// this many times in a row, 0 or 1 applies changes immediately.
+	ChangeDebounceCount int
+
+	// Clock defaults to RealClock, tests can pass a FakeClock.
+	Clock Clock
+
+	// Logger defaults to cloudflare.SilentLeveledLogger. A Logger which also
+	// implements FieldLogger gets the changes of updated records as fields.
+	Logger cloudflare.LeveledLoggerInterface
+	// OnResult, if set, is called by Run after every update.
+	OnResult func(Result, error)
+}
+
+// ErrCycleBudgetExhausted is wrapped by the error of an update that was
+// abandoned because it exceeded Config.CycleBudget.
+var ErrCycleBudgetExhausted = errors.New("cycle budget exhausted")
+
+// Updater updates the configured records, see New.
+type Updater struct {
+	config     Config
+	logger     cloudflare.LeveledLoggerInterface
+	clock      Clock
+	ip_clients map[string]*http.Client
+
+	// api is replaced by SetAPIToken, use client
+	api_mutex sync.RWMutex
+	api       *cloudflare.API
+
+	resolve_cache *resolveCache
+
+	ip_endpoint_mutex sync.Mutex
+	ip_endpoint_last  map[string]int
+
+	failure_mutex   sync.Mutex
+	failure_streaks map[string]*FailureStreak
+
+	detections map[string]*DetectionRing
+	breaker    *CircuitBreaker
+
+	// start_reconciles are pending per family, see Config.ReconcileOnStart
+	start_reconciles map[string]*atomic.Bool
+
+	ttl_mutex    sync.Mutex
+	restore_ttls map[string]int
+
+	write_mutex sync.Mutex
+	last_writes map[string]lastWrite
+
+	order_mutex    sync.Mutex
+	record_offsets map[string]int
+
+	ip_cache_mutex sync.Mutex
+	ip_cache       map[string]cachedIP
+
+	// zone_id is set if the zone was given by its id instead of its name
+	zone_id     string
+	zone_paused atomic.Bool
+
+	// looked_up_zone_id is the id of the zone looked up by its name in
+	// preflight, see ZoneID
+	looked_up_zone_id string
+
+	// name_servers of the zone, read in preflight
+	name_servers           []string
+	authoritative_resolver *net.Resolver
+}
+
+// FailureStreak tracks consecutive failed updates of one ip family.
+type FailureStreak struct {
+	count int
+	since time.Time
+}
+
+// New validates the config, creates the cloudflare api client and verifies
+// that the api token can read the configured records.
+func New(config Config) (*Updater, error) {
+	if config.APIToken == "" {
+		return nil, errors.New("no api token given")
+	}
+	if config.ZoneName == "" && config.ZoneID == "" {
+		return nil, errors.New("no zone name or id given")
+	}
+	if config.RecordName == "" && config.RecordComment == "" && config.RecordID == "" {
+		return nil, errors.New("no record name, comment or id given")
+	}
+	if config.RecordID != "" && (config.RecordComment != "" || config.CNAMETarget != "" || config.WWWCNAME) {
+		return nil, errors.New("a record id can not be combined with a record comment, a CNAME target or a www CNAME")
+	}
+	if config.CNAMETarget != "" && (config.RecordComment != "" || config.WWWCNAME || config.RecordType != "") {
+		return nil, errors.New("a CNAME target can only be combined with a record name")
+	}
+	if config.CNAMETarget != "" && config.ResolveHostname != "" {
+		return nil, errors.New("a CNAME target can not be combined with resolving a hostname")
+	}
+	if config.Interface != "" && (config.CNAMETarget != "" || config.ResolveHostname != "") {
+		return nil, errors.New("an interface can not be combined with a CNAME target or resolving a hostname")
+	}
+	if config.CurrentIP != nil && (config.CNAMETarget != "" || config.ResolveHostname != "" || config.Interface != "") {
+		return nil, errors.New("a given ip source can not be combined with a CNAME target, resolving a hostname or an interface")
+	}
+	if config.CNAMETarget != "" || config.ResolveHostname != "" || config.Interface != "" || config.CurrentIP != nil {
+		// there is no endpoint to probe
+		config.SkipProbe = true
+	}
+	if config.WWWCNAME && config.RecordComment != "" {
+		return nil, errors.New("maintaining a www CNAME requires the apex record to be given by name, not by comment")
+	}
+	switch config.LookupStrategy {
+	case "":
+		config.LookupStrategy = LookupList
+		if config.RecordID != "" {
+			config.LookupStrategy = LookupID
+		}
+	case LookupList:
+	case LookupResolve:
+		if config.RecordName == "" || config.RecordComment != "" || config.CNAMETarget != "" {
+			return nil, errors.New("the resolve lookup strategy requires the record to be given by name")
+		}
+	case LookupID:
+		if config.RecordID == "" {
+			return nil, errors.New("the id lookup strategy requires a record id")
+		}
+	default:
+		return nil, fmt.Errorf("lookup strategy '%s' is not supported, use 'list', 'resolve' or 'id'", config.LookupStrategy)
+	}
+	if config.ResolveAuthoritative && config.LookupStrategy != LookupResolve {
+		return nil, errors.New("resolving authoritatively requires the resolve lookup strategy")
+	}
+	switch config.MultiRecordStrategy {
+	case "", "last", "first", "all", "error", "skip":
+	default:
+		return nil, fmt.Errorf("multi record strategy '%s' is not supported, use 'last', 'first', 'all', 'error' or 'skip'", config.MultiRecordStrategy)
+	}
+	if config.RestoreOnly && (config.RecordComment != "" || config.RecordID != "" || config.CNAMETarget != "") {
+		return nil, errors.New("restore-only mode requires the record to be given by name")
+	}
+	for record_type, create := range config.CreateMissing {
+		if create && (config.RecordComment != "" || config.CNAMETarget != "") {
+			return nil, fmt.Errorf("creating missing %s records requires the record to be given by name", record_type)
+		}
+	}
+	if config.DesiredComment != "" && config.RecordComment != "" {
+		return nil, errors.New("a desired comment can not be combined with selecting records by comment")
+	}
+	if len(config.RecordAliases) > 0 && (config.RecordComment != "" || config.CNAMETarget != "") {
+		return nil, errors.New("record aliases can only be combined with a record name")
+	}
+	if len(config.Mirrors) > 0 && (config.CNAMETarget != "" || config.RestoreOnly) {
+		return nil, errors.New("mirrors can not be combined with a CNAME target or restore-only mode")
+	}
+	if config.InstanceID != "" && (config.RecordComment != "" || strings.ContainsAny(config.InstanceID, " \t")) {
+		return nil, errors.New("an instance id can not contain spaces and can not be combined with selecting records by comment")
+	}
+	if config.HALock != "" && config.InstanceID == "" {
+		return nil, errors.New("a lock requires an instance id to tell its holder")
+	}
+	if config.ExpectedGatewayMAC != nil && runtime.GOOS != "linux" {
+		return nil, errors.New("checking the gateway mac address is only supported on linux")
+	}
+	if config.Logger == nil {
+		config.Logger = cloudflare.SilentLeveledLogger
+	}
+	zone_id := config.ZoneID
+	if zone_id == "" && zone_id_pattern.MatchString(config.ZoneName) {
+		zone_id = config.ZoneName
+	}
+	if zone_id == "" {
+		qualifyRecordNames(&config)
+	}
+	// otherwise the zone name is read from the id in preflight
+	if !config.LiteralRecordName {
+		mirrors := []Mirror{}
+		for _, mirror := range config.Mirrors {
+			mirrors = append(mirrors, Mirror{Zone: mirror.Zone, Record: qualifyRecordName(mirror.Record, mirror.Zone, config.Logger)})
+		}
+		config.Mirrors = mirrors
+	}
+	if config.RecordComment != "" {
+		config.RecordName = "comment:" + config.RecordComment
+	}
+
+	if len(config.Endpoints) < 1 {
+		config.Endpoints = []IPEndpoint{{URL: "https://icanhazip.com"}}
+	}
+	if len(config.Families) < 1 {
+		config.Families = []string{""}
+	}
+	for _, family := range config.Families {
+		if family != "" && family != "4" && family != "6" {
+			return nil, fmt.Errorf("ip family '%s' is not supported, use '4' or '6'", family)
+		}
+	}
+	if config.RecordType != "" {
+		family := map[string]string{"A": "4", "AAAA": "6"}[config.RecordType]
+		if family == "" {
+			return nil, fmt.Errorf("record type '%s' is not supported, use 'A' or 'AAAA'", config.RecordType)
+		}
+		if len(config.Families) > 1 || config.Families[0] != "" && config.Families[0] != family {
+			return nil, fmt.Errorf("record type '%s' contradicts the configured ip families %v", config.RecordType, config.Families)
+		}
+		config.Families = []string{family}
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	intervals := map[string]time.Duration{}
+	for family, interval := range config.Intervals {
+		intervals[family] = interval
+	}
+	config.Intervals = intervals
+	if config.Clock == nil {
+		config.Clock = RealClock{}
+	}
+	if config.IPMaxRedirects == 0 {
+		config.IPMaxRedirects = default_ip_max_redirects
+	} else if config.IPMaxRedirects < 0 {
+		config.IPMaxRedirects = 0
+	}
+	if config.IPRetryDelay <= 0 {
+		config.IPRetryDelay = time.Second
+	}
+	if config.APIRetryDelay <= 0 {
+		config.APIRetryDelay = 10 * time.Second
+	}
+	if config.ZoneLookupRetryDelay <= 0 {
+		config.ZoneLookupRetryDelay = time.Second
+	}
+
+	u := &Updater{
+		config:           config,
+		logger:           config.Logger,
+		clock:            config.Clock,
+		ip_clients:       map[string]*http.Client{},
+		ip_endpoint_last: map[string]int{},
+		failure_streaks:  map[string]*FailureStreak{},
+		detections:       map[string]*DetectionRing{},
+		restore_ttls:     map[string]int{},
+		last_writes:      map[string]lastWrite{},
+		record_offsets:   map[string]int{},
+		ip_cache:         map[string]cachedIP{},
+		zone_id:          zone_id,
+	}
+	if config.ReconcileOnStart {
+		u.start_reconciles = newStartReconciles(config.Families)
+	}
+	if config.ChangeDebounceCount > 1 {
+		for _, family := range config.Families {
+			u.detections[family] = NewDetectionRing(config.ChangeDebounceCount)
+		}
+	}
+
+	if config.CircuitBreakerThreshold > 0 {
+		if config.CircuitBreakerCooldown <= 0 {
+			config.CircuitBreakerCooldown = time.Minute
+		}
+		u.breaker = NewCircuitBreaker(config.CircuitBreakerThreshold, config.CircuitBreakerCooldown, func(state string) {
+			switch state {
+			case CircuitOpen:
+				u.logger.Errorf("cloudflare api failed %d times in a row, circuit breaker opened for %s\n", config.CircuitBreakerThreshold, config.CircuitBreakerCooldown.String())
+			case CircuitHalfOpen:
+				u.logger.Infof("circuit breaker is half-open, trying the cloudflare api again\n")
+			case CircuitClosed:
+				u.logger.Infof("cloudflare api recovered, circuit breaker closed\n")
+			}
+			if config.OnCircuitStateChange != nil {
+				config.OnCircuitStateChange(state)
+			}
+		})
+		u.breaker.clock = u.clock
+	}
+
+	api, err := cloudflare.NewWithAPIToken(config.APIToken, config.APIOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cloudflare api client with the provided token, %w", err)
+	}
+	u.api = api
+
+	if err := u.preflight(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if config.ResolveAuthoritative {
+		if len(u.name_servers) < 1 {
+			return nil, errors.New("the nameservers of the zone could not be read, resolving authoritatively requires the 'Zone:Read' permission")
+		}
+		u.logger.Infof("resolving the records at the nameservers of the zone %v\n", u.name_servers)
+		u.authoritative_resolver = newAuthoritativeResolver(u.name_servers)
+	}
+	if config.ResolveCacheTTL > 0 {
+		u.resolve_cache = newResolveCache(config.ResolveCacheTTL, u.clock)
+	}
+	for _, network := range []string{"tcp", "tcp4", "tcp6"} {
+		u.ip_clients[network] = u.newIPClient(network)
+	}
+
+	if !config.SkipProbe {
+		for _, family := range config.Families {
+			reachable := 0
+			for _, endpoint := range u.endpointsForFamily(family) {
+				if _, err := u.requestIP(context.Background(), u.config.Endpoints[endpoint], family); err != nil {
+					u.logger.Warnf("current ip info endpoint '%s' could not be requested: %s\n", u.config.Endpoints[endpoint].URL, err.Error())
+					continue
+				}
+				reachable++
+			}
+			if reachable < 1 {
+				return nil, errors.New("none of the current ip info endpoints could be requested")
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// qualifyRecordName appends the zone to a record name that is not within the
+// zone yet, e.g. "home" becomes "home.example.com", "@" is the zone apex.
+func qualifyRecordName(name string, zone string, logger cloudflare.LeveledLoggerInterface) string {
+	normalized, normalized_zone := strings.ToLower(strings.TrimSuffix(name, ".")), strings.ToLower(strings.TrimSuffix(zone, "."))
+	if normalized == normalized_zone || strings.HasSuffix(normalized, "."+normalized_zone) {
+		return name
+	}
+	qualified := zone
+	if name != "@" {
+		qualified = strings.TrimSuffix(name, ".") + "." + zone
+	}
+	logger.Infof("record name '%s' is not within zone '%s', using '%s'\n", name, zone, qualified)
+	return qualified
+}
+
+// zone_id_pattern matches zone ids, which are pasted as zone names quite often
+var zone_id_pattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func qualifyRecordNames(config *Config) {
+	if config.HALock != "" {
+		config.HALock = qualifyRecordName(config.HALock, config.ZoneName, config.Logger)
+	}
+	if config.RecordName == "" || config.LiteralRecordName {
+		return
+	}
+	config.RecordName = qualifyRecordName(config.RecordName, config.ZoneName, config.Logger)
+	aliases := []string{}
+	for _, alias := range config.RecordAliases {
+		aliases = append(aliases, qualifyRecordName(alias, config.ZoneName, config.Logger))
+	}
+	config.RecordAliases = aliases
+}
+
+func (u *Updater) interval(family string) time.Duration {
+	if interval, exists := u.config.Intervals[family]; exists {
+		return interval
+	}
+	return u.config.Interval
+}
+
+// contentMatches compares record contents the way cloudflare does, addresses
+// are compared parsed since IPv6 has many spellings (2001:DB8::1, 2001:db8:0::1)
+// and hostname contents (e.g. of CNAME records) are case insensitive and may or
+// may not carry a trailing dot.
+func contentMatches(record_type string, live string, desired string) bool {
+	switch record_type {
+	case "A", "AAAA":
+		live_ip, desired_ip := net.ParseIP(live), net.ParseIP(desired)
+		if live_ip == nil || desired_ip == nil {
+			return live == desired
+		}
+		return live_ip.Equal(desired_ip)
+	default:
+		normalize := func(content string) string {
+			return strings.TrimSuffix(strings.ToLower(content), ".")
+		}
+		return normalize(live) == normalize(desired)
+	}
+}
+
+// cgnat_range is the shared address space of RFC 6598 used for carrier-grade NAT
+var cgnat_range = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func recordTypeForFamily(family string) string {
+	if family == "6" {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// changedFields lists the names of the fields that changed between two
+// versions of a record.
+func changedFields(before cloudflare.DNSRecord, after cloudflare.DNSRecord) []string {
+	fields := []string{}
+	if before.Content != after.Content {
+		fields = append(fields, "content")
+	}
+	if before.TTL != after.TTL {
+		fields = append(fields, "ttl")
+	}
+	if before.Proxied != nil && after.Proxied != nil && *before.Proxied != *after.Proxied {
+		fields = append(fields, "proxied")
+	}
+	if before.Comment != after.Comment {
+		fields = append(fields, "comment")
+	}
+	return fields
+}
+
+// diffRecord describes the fields that changed between two versions of a record.
+func diffRecord(before cloudflare.DNSRecord, after cloudflare.DNSRecord) string {
+	changes := []string{}
+	for _, field := range changedFields(before, after) {
+		switch field {
+		case "content":
+			changes = append(changes, fmt.Sprintf("content %s -> %s", before.Content, after.Content))
+		case "ttl":
+			changes = append(changes, fmt.Sprintf("ttl %d -> %d", before.TTL, after.TTL))
+		case "proxied":
+			changes = append(changes, fmt.Sprintf("proxied %t -> %t", *before.Proxied, *after.Proxied))
+		case "comment":
+			changes = append(changes, fmt.Sprintf("comment '%s' -> '%s'", before.Comment, after.Comment))
+		}
+	}
+	if len(changes) < 1 {
+		return "no fields changed"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// FieldLogger is implemented by loggers that log structured fields along with
+// a message, like the json logger of the cloudflare-ddns binary.
+type FieldLogger interface {
+	InfoWith(message string, fields map[string]any)
+}
+
+// recordFields are the fields of a record logged by logChange.
+func recordFields(record cloudflare.DNSRecord) map[string]any {
+	fields := map[string]any{"content": record.Content, "ttl": record.TTL, "comment": record.Comment}
+	if record.Proxied != nil {
+		fields["proxied"] = *record.Proxied
+	}
+	return fields
+}
+
+// logChange logs a message followed by the changes of a record, with a
+// FieldLogger also as the record, old, new and changed fields.
+func (u *Updater) logChange(message string, before cloudflare.DNSRecord, after cloudflare.DNSRecord) {
+	message = fmt.Sprintf("%s: %s", message, diffRecord(before, after))
+	logger, ok := u.logger.(FieldLogger)
+	if !ok {
+		u.logger.Infof("%s\n", message)
+		return
+	}
+	logger.InfoWith(message, map[string]any{
+		"record":  before.Name,
+		"old":     recordFields(before),
+		"new":     recordFields(after),
+		"changed": changedFields(before, after),
+	})
+}
+
+// recordContent formats an ip as the content of a record, keeping an
+// IPv4-mapped address in its IPv6 form for AAAA records.
+func recordContent(record_type string, ip net.IP) string {
+	if record_type == "AAAA" && ip.To4() != nil {
+		return "::ffff:" + ip.To4().String()
+	}
+	return ip.String()
+}
+
+func recordTypeForIP(ip net.IP) string {
+	if ip.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// recordFailure logs a failed update, the first failure of a streak as a
+// warning and every following one as an error with the streak so far.
+func (u *Updater) recordFailure(family string, err error) {
+	u.failure_mutex.Lock()
+	defer u.failure_mutex.Unlock()
+
+	streak, exists := u.failure_streaks[family]
+	if !exists {
+		streak = &FailureStreak{since: u.clock.Now()}
+		u.failure_streaks[family] = streak
+	}
+	streak.count++
+
+	if streak.count == 1 {
+		u.logger.Warnf("update failed, retrying in %s: %s\n", u.interval(family).String(), err.Error())
+		return
+	}
+	u.logger.Errorf("update failed %d times in a row over %s: %s\n", streak.count, u.clock.Now().Sub(streak.since).Round(time.Second).String(), err.Error())
+}
+
+func (u *Updater) recordSuccess(family string) {
+	u.failure_mutex.Lock()
+	defer u.failure_mutex.Unlock()
+
+	if streak, exists := u.failure_streaks[family]; exists {
+		u.logger.Infof("recovered after %d failures over %s\n", streak.count, u.clock.Now().Sub(streak.since).Round(time.Second).String())
+		delete(u.failure_streaks, family)
+	}
+}
+
+// managedRecords lists the records to update, a record name selects a single
+// record (see MultiRecordStrategy) and its aliases, a comment selects all
+// records carrying it.
+func (u *Updater) managedRecords(ctx context.Context, rc *cloudflare.ResourceContainer, record_type string) ([]cloudflare.DNSRecord, error) {
+	if u.config.LookupStrategy == LookupID {
+		record, err := u.client().GetDNSRecord(ctx, rc, u.config.RecordID)
+		u.breaker.Record(err)
+		if err != nil {
+			return nil, fmt.Errorf("could not read record '%s': %w", u.config.RecordID, err)
+		}
+		if record.Type != record_type {
+			return nil, fmt.Errorf("record '%s' is a %s record, not a %s record", u.config.RecordID, record.Type, record_type)
+		}
+		lookup, err := u.lookupRecords(ctx, rc, record_type)
+		if err != nil {
+			return nil, err
+		}
+		return u.withAliases(lookup, record_type, []cloudflare.DNSRecord{record})
+	}
+
+	if u.config.RecordComment != "" {
+		records, _, err := u.client().ListDNSRecords(ctx, rc, u.recordsParams(record_type))
+		u.breaker.Record(err)
+		if err != nil {
+			return nil, fmt.Errorf("could not list records for '%s': %w", u.config.RecordName, err)
+		}
+		if len(records) < 1 {
+			return nil, fmt.Errorf("no %s records found for '%s'", record_type, u.config.RecordName)
+		}
+		return records, nil
+	}
+
+	lookup, err := u.lookupRecords(ctx, rc, record_type)
+	if err != nil {
+		return nil, err
+	}
+	records, err := lookup(u.config.RecordName)
+	if err != nil {
+		return nil, fmt.Errorf("could not list records for '%s': %w", u.config.RecordName, err)
+	}
+	if len(records) < 1 {
+		return nil, &missingRecordError{record_type: record_type, name: u.config.RecordName}
+	}
+	if len(records) > 1 {
+		u.logDuplicates(records)
+	}
+
+	switch u.config.MultiRecordStrategy {
+	case "skip":
+		if len(records) > 1 {
+			return records, errDuplicatesSkipped
+		}
+	case "all":
+		return u.withAliases(lookup, record_type, records)
+	case "first":
+		return u.withAliases(lookup, record_type, records[:1])
+	case "error":
+		if len(records) > 1 {
+			return nil, fmt.Errorf("%d %s records found for '%s', refusing to pick one", len(records), record_type, u.config.RecordName)
+		}
+	}
+	return u.withAliases(lookup, record_type, records[len(records)-1:])
+}
+
+// withAliases appends the records of the configured aliases to targets.
+func (u *Updater) withAliases(lookup recordLookup, record_type string, targets []cloudflare.DNSRecord) ([]cloudflare.DNSRecord, error) {
+	for _, alias := range u.config.RecordAliases {
+		alias_records, err := lookup(alias)
+		if err != nil {
+			return nil, fmt.Errorf("could not list records for alias '%s': %w", alias, err)
+		}
+		if len(alias_records) < 1 {
+			return nil, &missingRecordError{record_type: record_type, name: alias, alias: true}
+		}
+		targets = append(targets, alias_records[len(alias_records)-1])
+	}
+	return targets, nil
+}
+
+// logGroup logs a single success once every record of a group is up-to-date,
+// or which records are and which are not after a partial failure.
+func (u *Updater) logGroup(check *Check) {
+	succeeded, failed := []string{}, []string{}
+	for _, record := range check.Records {
+		if record.Action == "failed" {
+			failed = append(failed, record.Name)
+		} else {
+			succeeded = append(succeeded, record.Name)
+		}
+	}
+	if len(failed) < 1 {
+		u.logger.Infof("all %d %s records of the group are up-to-date\n", len(succeeded), check.RecordType)
+		return
+	}
+	u.logger.Errorf("group of %s records was only partially updated, up-to-date: [%s], failed: [%s]\n", check.RecordType, strings.Join(succeeded, ", "), strings.Join(failed, ", "))
+}
+
+func (u *Updater) recordsParams(record_type string) cloudflare.ListDNSRecordsParams {
+	if u.config.RecordComment != "" {
+		return cloudflare.ListDNSRecordsParams{Type: record_type, Comment: u.config.RecordComment}
+	}
+	return cloudflare.ListDNSRecordsParams{Type: record_type, Name: u.config.RecordName}
+}
+
+// UpdateOnce updates the records of every configured ip family once, the
+// error is the one of Result.Err.
+func (u *Updater) UpdateOnce(ctx context.Context) (Result, error) {
+	result := Result{CheckedAt: u.clock.Now()}
+	for _, family := range u.config.Families {
+		result.Checks = append(result.Checks, u.check(ctx, family))
+	}
+	result.Duration = u.clock.Now().Sub(result.CheckedAt)
+	return result, result.Err()
+}
+
+// Run updates the records every interval until the context is cancelled.
+func (u *Updater) Run(ctx context.Context) error {
+	for _, family := range u.config.Families[1:] {
+		go u.schedule(ctx, family)
+	}
+	u.schedule(ctx, u.config.Families[0])
+	return ctx.Err()
+}
+
+func (u *Updater) schedule(ctx context.Context, family string) {
+	ticker := u.clock.NewTicker(u.interval(family))
+	defer ticker.Stop()
+	for {
+		go u.update(ctx, family)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (u *Updater) update(ctx context.Context, family string) {
+	u.logger.Infof("CLOUDFLARE DDNS update started " + strings.Repeat("-", 19) + "\n")
+
+	result := Result{CheckedAt: u.clock.Now()}
+	check := u.check(ctx, family)
+	result.Checks = []Check{check}
+	result.Duration = u.clock.Now().Sub(result.CheckedAt)
+
+	if u.config.OnResult != nil {
+		u.config.OnResult(result, check.Err)
+	}
+
+	if check.Err != nil {
+		u.recordFailure(family, check.Err)
+		return
+	}
+	u.recordSuccess(family)
+
+	u.logger.Infof("CLOUDFLARE DDNS update finished " + strings.Repeat("-", 18) + "\n")
+}
+
+func (u *Updater) check(ctx context.Context, family string) (check Check) {
+	started := u.clock.Now()
+	check = Check{RecordType: recordTypeForFamily(family)}
+	defer func() { check.Duration = u.clock.Now().Sub(started) }()
+	if u.config.CycleBudget <= 0 {
+		check.Err = u.updateRecord(ctx, family, &check)
+		return check
+	}
+
+	budget_ctx, cancel := context.WithTimeout(ctx, u.config.CycleBudget)
+	defer cancel()
+	check.Err = u.updateRecord(budget_ctx, family, &check)
+	if check.Err != nil && budget_ctx.Err() != nil && ctx.Err() == nil {
+		u.logger.Warnf("cycle budget of %s is exhausted, abandoning the update until the next one\n", u.config.CycleBudget.String())
+		check.Err = fmt.Errorf("%w: %w", ErrCycleBudgetExhausted, check.Err)
+	}
+	return check
+}
+
+// listZones lists the zones of the given name, restricted to the configured
+// account if any.
+func (u *Updater) listZones(ctx context.Context, name string) ([]cloudflare.Zone, error) {
+	zones, err := u.client().ListZones(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	matching := []cloudflare.Zone{}
+	for _, zone := range zones {
+		if u.config.AccountID != "" && zone.Account.ID != u.config.AccountID {
+			continue
+		}
+		matching = append(matching, zone)
+	}
+	return matching, nil
+}
+
+// zoneIdentifier looks up the configured zone.
+func (u *Updater) zoneIdentifier(ctx context.Context) (*cloudflare.ResourceContainer, error) {
+	// a known zone id needs no api call, but the open circuit still stops the
+	// calls that follow
+	if err := u.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	if u.zone_id != "" {
+		return cloudflare.ZoneIdentifier(u.zone_id), nil
+	}
+
+	zones, err := u.listZones(ctx, u.config.ZoneName)
+	u.breaker.Record(err)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not list zones: %w", err)
+	}
+
+	if len(zones) < 1 {
+		return nil, fmt.Errorf("no zones found for '%s'", u.config.ZoneName)
+	}
+
+	u.zone_paused.Store(zones[len(zones)-1].Paused)
+	return cloudflare.ZoneIdentifier(zones[len(zones)-1].ID), nil
+}
+
+// detectIP fetches the current ip, retrying the whole endpoint fallback chain
+// with a constant delay, endpoints are cheap to ask again.
+func (u *Updater) detectIP(ctx context.Context, family string) (net.IP, error) {
+	for attempt := 0; ; attempt++ {
+		var current_ip net.IP
+		var err error
+		if u.config.ResolveHostname != "" {
+			current_ip, err = u.resolveIP(ctx, family)
+		} else if u.config.Interface != "" {
+			current_ip, err = u.interfaceIP(family)
+		} else if u.config.CurrentIP != nil {
+			current_ip, err = u.givenIP(family)
+		} else {
+			current_ip, err = u.cachedFetchIP(ctx, family)
+		}
+		// the family of the network does not change by retrying
+		if err == nil || attempt >= u.config.IPMaxRetries || u.config.StrictTLS && errors.Is(err, ErrEndpointTLS) || onlyFamilyMismatches(err) {
+			return current_ip, err
+		}
+		u.logger.Warnf("current IP address could not be determined, retrying in %s (%d/%d)\n", u.config.IPRetryDelay.String(), attempt+1, u.config.IPMaxRetries)
+		if err := u.clock.Sleep(ctx, u.config.IPRetryDelay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isTransient reports whether an error returned by one of our cloudflare api
+// calls wraps an api outage worth retrying, a blocked update never is.
+func isTransient(err error) bool {
+	if errors.Is(err, ErrZonePaused) || errors.Is(err, ErrRecordLocked) {
+		return false
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if isTransient(err) {
+				return true
+			}
+		}
+		return false
+	}
+	cause := errors.Unwrap(err)
+	return cause != nil && !errors.Is(err, ErrCircuitOpen) && isOutage(cause)
+}
+
+// retryAPI runs apply, retrying api outages with an exponential backoff
+// starting at the api retry delay, to stay polite to the cloudflare api.
+func (u *Updater) retryAPI(ctx context.Context, check *Check, apply func() error) error {
+	for attempt := 0; ; attempt++ {
+		check.Records = nil
+		err := apply()
+		if err == nil || attempt >= u.config.APIMaxRetries || !isTransient(err) {
+			return err
+		}
+		delay := u.config.APIRetryDelay << attempt
+		u.logger.Warnf("cloudflare api failed, retrying in %s (%d/%d): %s\n", delay.String(), attempt+1, u.config.APIMaxRetries, err.Error())
+		if err := u.clock.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (u *Updater) updateRecord(ctx context.Context, family string, check *Check) error {
+	if !u.onExpectedNetwork() {
+		return nil
+	}
+	if leader, err := u.holdLock(ctx, family); !leader {
+		return err
+	}
+
+	if u.config.CNAMETarget != "" {
+		return u.retryAPI(ctx, check, func() error {
+			return u.updateCNAMETarget(ctx, check)
+		})
+	}
+
+	current_ip, err := u.detectIP(ctx, family)
+
+	if err != nil && onlyFamilyMismatches(err) {
+		if u.config.SkipFamilyMismatch {
+			u.logger.Infof("not updating the %s record, only addresses of the other ip family could be detected\n", check.RecordType)
+			return nil
+		}
+		return fmt.Errorf("only addresses of the other ip family could be detected for the %s record, is the network single-stack? %w", check.RecordType, err)
+	}
+	if err != nil {
+		return fmt.Errorf("current IP address could not be determined from any endpoint: %w", err)
+	}
+
+	if u.config.IPv6HostSuffix != nil && current_ip.To4() == nil {
+		combined := u.config.IPv6HostSuffix.Apply(current_ip)
+		u.logger.Infof("combining the prefix of %s with host suffix %s into %s\n", current_ip.String(), u.config.IPv6HostSuffix.String(), combined.String())
+		current_ip = combined
+	}
+
+	// without a family the record type follows the detected address
+	if family == "" {
+		check.RecordType = recordTypeForIP(current_ip)
+	}
+
+	u.logger.Infof("current IP address is %s\n", current_ip.String())
+	check.IP = current_ip.String()
+
+	observed := u.config.ChangeDebounceCount
+	if detections, exists := u.detections[family]; exists {
+		observed = detections.Observe(current_ip.String())
+	}
+
+	if cgnat_range.Contains(current_ip) {
+		u.logger.Warnf("!!! current IP address %s is in the CGNAT range %s, your ISP is sharing it between customers and it is most likely not reachable from the internet !!!\n", current_ip.String(), cgnat_range.String())
+		if u.config.SkipCGNAT {
+			u.logger.Infof("not updating any records because skipping CGNAT addresses is enabled\n")
+			return nil
+		}
+	}
+
+	err = u.retryAPI(ctx, check, func() error {
+		return u.applyIP(ctx, family, current_ip, observed, check)
+	})
+	if err == nil {
+		u.finishStartReconcile(family)
+	}
+	return err
+}
+
+func (u *Updater) applyIP(ctx context.Context, family string, current_ip net.IP, observed int, check *Check) error {
+	record_type := check.RecordType
+	// never write an address into a record of the other family
+	if recordTypeForIP(current_ip) != record_type && !(record_type == "AAAA" && u.config.AllowMappedIPv6) {
+		return fmt.Errorf("%w, not writing %s into a %s record", ErrFamilyMismatch, current_ip.String(), record_type)
+	}
+	reconciling := u.startReconciling(family)
+	if reconciling {
+		u.logger.Infof("reconciling all records at startup, ignoring what is known about the current ip\n")
+	}
+
+	if u.config.LookupStrategy == LookupResolve && !u.config.ReconcileSettings && !reconciling && u.resolvesTo(ctx, record_type, current_ip) {
+		u.logger.Infof("'%s' already resolves to %s, not asking the api @ %s\n", u.config.RecordName, current_ip.String(), u.clock.Now().String())
+		for _, name := range append([]string{u.config.RecordName}, u.config.RecordAliases...) {
+			check.Records = append(check.Records, RecordResult{Name: name, Action: "unchanged", Content: current_ip.String()})
+		}
+		return nil
+	}
+
+	rc, err := u.zoneIdentifier(ctx)
+	if err != nil {
+		return err
+	}
+
+	if u.config.RestoreOnly {
+		return u.restoreRecords(ctx, rc, record_type, current_ip, check)
+	}
+
+	targets, created, err := u.managedOrCreatedRecords(ctx, rc, record_type, current_ip, check)
+	if errors.Is(err, errDuplicatesSkipped) {
+		u.logger.Warnf("not updating the %d %s records of '%s', duplicates are skipped\n", len(targets), record_type, u.config.RecordName)
+		for _, record := range targets {
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "skipped", Content: record.Content})
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	targets = u.shuffleTargets(family, targets)
+
+	updates := 0
+	errs := []error{}
+	for _, record := range targets {
+		if created[record.ID] {
+			continue
+		}
+		u.logger.Infof("current content of '%s' in zone '%s' is %s\n", record.Name, u.config.ZoneName, record.Content)
+		u.warnConflict(record, family)
+
+		if contentMatches(record.Type, record.Content, current_ip.String()) {
+			if reconciled, err := u.reconcileSettings(ctx, rc, record, reconciling, check); reconciled {
+				if err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			u.logger.Infof("record is already up-to-date @ %s\n", u.clock.Now().String())
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "unchanged", Content: record.Content})
+			if err := u.restoreTTL(ctx, rc, record); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if !u.inUpdateWindow(record.Name) {
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "outside_window", Content: record.Content})
+			continue
+		}
+
+		if !reconciling && observed < u.config.ChangeDebounceCount {
+			u.logger.Infof("record is not up-to-date, but %s has only been detected %d of %d times in a row, waiting...\n", current_ip.String(), observed, u.config.ChangeDebounceCount)
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "debounced", Content: record.Content})
+			continue
+		}
+
+		if !reconciling && u.suppressWrite(record, current_ip.String()) {
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "suppressed", Content: record.Content})
+			continue
+		}
+
+		if err := u.blocked(record, nil); err != nil {
+			if err := u.skipBlocked(record, err, check); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if current_record, noop := u.isNoop(ctx, rc, record, current_ip.String()); noop {
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "noop", Content: current_record.Content})
+			continue
+		}
+
+		if updates > 0 && u.config.RecordUpdateStagger > 0 {
+			if err := u.clock.Sleep(ctx, u.config.RecordUpdateStagger); err != nil {
+				return err
+			}
+		}
+		updates++
+
+		u.logger.Infof("record is not up-to-date, updating...\n")
+		params := cloudflare.UpdateDNSRecordParams{
+			ID:      record.ID,
+			Content: recordContent(record.Type, current_ip),
+			TTL:     u.lowerTTL(record),
+		}
+		u.withSettings(record, &params, reconciling)
+		u.withInstance(record, &params)
+		updated_record, err := u.client().UpdateDNSRecord(ctx, rc, params)
+		u.breaker.Record(err)
+
+		if blocked_err := u.blocked(record, err); blocked_err != nil {
+			if err := u.skipBlocked(record, blocked_err, check); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err != nil {
+			check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "failed", Content: record.Content})
+			if isAuthorizationError(err) {
+				errs = append(errs, fmt.Errorf("could not update record '%s', the api token is missing the 'DNS:Edit' permission for zone '%s': %w", record.Name, u.config.ZoneName, err))
+			} else {
+				errs = append(errs, fmt.Errorf("could not update record '%s' in zone '%s': %w", record.Name, u.config.ZoneName, err))
+			}
+			continue
+		}
+		u.logChange(fmt.Sprintf("record '%s' has been successfully updated", record.Name), record, updated_record)
+		u.recordWrite(updated_record)
+		check.Records = append(check.Records, RecordResult{Name: record.Name, Action: "updated", Content: updated_record.Content, PreviousContent: record.Content})
+	}
+
+	if len(targets) > 1 {
+		u.logGroup(check)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// the mirrors follow the detected ip once a managed record has it, not
+	// while it is debounced or outside of the update window
+	if len(u.config.Mirrors) > 0 && hasContent(check, record_type, current_ip.String()) {
+		if err := u.syncMirrors(ctx, record_type, recordContent(record_type, current_ip), check); err != nil {
+			return err
+		}
+	}
+
+	// in dual-stack mode the CNAME is maintained by the first family only
+	if u.config.WWWCNAME && family == u.config.Families[0] {
+		return u.ensureWWWCNAME(ctx, rc, check)
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+const (
+	test_zone_name = "example.com"
+	test_zone_id   = "023e105f4ecef8ad9ca31a8372d0c353"
+)
+
+// fakeAPI serves the zone test_zone_name and its dns records from memory like
+// the cloudflare api, and records the writes made to them.
+type fakeAPI struct {
+	mutex   sync.Mutex
+	records []cloudflare.DNSRecord
+	patches []string
+	creates []cloudflare.DNSRecord
+	// reject_unqualified rejects listing names outside of the zone, like the
+	// api rejects names it can not validate
+	reject_unqualified bool
+}
+
+func newFakeAPI(t *testing.T, records ...cloudflare.DNSRecord) (*fakeAPI, *httptest.Server) {
+	api := &fakeAPI{records: records}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, server
+}
+
+func (f *fakeAPI) respond(writer http.ResponseWriter, status int, result interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if status >= http.StatusBadRequest {
+		json.NewEncoder(writer).Encode(map[string]interface{}{"success": false, "errors": []map[string]interface{}{{"code": 1004, "message": result}}})
+		return
+	}
+	json.NewEncoder(writer).Encode(map[string]interface{}{"success": true, "result": result})
+}
+
+func (f *fakeAPI) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	records_path := "/zones/" + test_zone_id + "/dns_records"
+	path := request.URL.Path
+	switch {
+	case path == "/user/tokens/verify":
+		f.respond(writer, http.StatusOK, map[string]string{"id": "token", "status": "active"})
+	case path == "/zones":
+		f.respond(writer, http.StatusOK, []cloudflare.Zone{{ID: test_zone_id, Name: test_zone_name}})
+	case path == records_path && request.Method == http.MethodGet:
+		query := request.URL.Query()
+		name := query.Get("name")
+		if f.reject_unqualified && name != "" && !strings.HasSuffix(name, "."+test_zone_name) && name != test_zone_name {
+			f.respond(writer, http.StatusBadRequest, "DNS name is invalid.")
+			return
+		}
+		matching := []cloudflare.DNSRecord{}
+		for _, record := range f.records {
+			if (query.Get("type") == "" || record.Type == query.Get("type")) && (name == "" || record.Name == name) && (query.Get("comment") == "" || record.Comment == query.Get("comment")) {
+				matching = append(matching, record)
+			}
+		}
+		f.respond(writer, http.StatusOK, matching)
+	case path == records_path && request.Method == http.MethodPost:
+		var record cloudflare.DNSRecord
+		json.NewDecoder(request.Body).Decode(&record)
+		record.ID = fmt.Sprintf("created-%d", len(f.creates)+1)
+		f.creates = append(f.creates, record)
+		f.records = append(f.records, record)
+		f.respond(writer, http.StatusOK, record)
+	case strings.HasPrefix(path, records_path+"/"):
+		id := strings.TrimPrefix(path, records_path+"/")
+		for i, record := range f.records {
+			if record.ID != id {
+				continue
+			}
+			if request.Method == http.MethodPatch {
+				f.patches = append(f.patches, id)
+				json.NewDecoder(request.Body).Decode(&f.records[i])
+			}
+			f.respond(writer, http.StatusOK, f.records[i])
+			return
+		}
+		f.respond(writer, http.StatusNotFound, "Record not found.")
+	default:
+		f.respond(writer, http.StatusNotFound, "No route for that URI.")
+	}
+}
+
+// Patches returns the ids of the records that were updated, in order.
+func (f *fakeAPI) Patches() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.patches...)
+}
+
+// Creates returns the records that were created, in order.
+func (f *fakeAPI) Creates() []cloudflare.DNSRecord {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]cloudflare.DNSRecord{}, f.creates...)
+}
+
+// newIPEndpoint serves ip as the current ip.
+func newIPEndpoint(t *testing.T, ip string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintln(writer, ip)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestUpdater creates an updater of the zone served by server, asking an
+// endpoint serving current_ip unless config has endpoints of its own.
+func newTestUpdater(t *testing.T, server *httptest.Server, config Config, current_ip string) *Updater {
+	t.Helper()
+	config.APIToken = "token"
+	config.ZoneName = test_zone_name
+	config.APIOptions = append(config.APIOptions, cloudflare.BaseURL(server.URL), cloudflare.UsingRateLimit(1000))
+	if len(config.Endpoints) < 1 {
+		config.Endpoints = []IPEndpoint{{URL: newIPEndpoint(t, current_ip).URL}}
+		// the endpoint only listens on IPv4
+		config.SkipProbe = true
+	}
+	u, err := New(config)
+	if err != nil {
+		t.Fatalf("New() failed: %s", err.Error())
+	}
+	return u
+}
+
+// testLogger collects the log lines of an updater.
+type testLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) log(format string, v ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Errorf(format string, v ...interface{}) { l.log(format, v...) }
+func (l *testLogger) Warnf(format string, v ...interface{})  { l.log(format, v...) }
+func (l *testLogger) Infof(format string, v ...interface{})  { l.log(format, v...) }
+func (l *testLogger) Debugf(format string, v ...interface{}) { l.log(format, v...) }
+
+// Logged reports whether a line containing text was logged.
+func (l *testLogger) Logged(text string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldTestLogger also collects the fields of the lines logged with InfoWith.
+type fieldTestLogger struct {
+	testLogger
+	fields []map[string]any
+}
+
+func (l *fieldTestLogger) InfoWith(message string, fields map[string]any) {
+	l.log("%s\n", message)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.fields = append(l.fields, fields)
+}
+
+func actions(check Check) []string {
+	actions := []string{}
+	for _, record := range check.Records {
+		actions = append(actions, record.Name+":"+record.Action)
+	}
+	return actions
+}
+
+func TestContentMatches(t *testing.T) {
+	tests := []struct {
+		record_type string
+		live        string
+		desired     string
+		matches     bool
+	}{
+		{"CNAME", "Target.", "target", true},
+		{"CNAME", "target", "Target.", true},
+		{"CNAME", "Home.Example.com.", "home.example.com", true},
+		{"CNAME", "home.example.com", "www.example.com", false},
+		{"A", "198.51.100.7", "198.51.100.7", true},
+		{"A", "198.51.100.7", "198.51.100.8", false},
+		{"A", "not an ip", "not an ip", true},
+		{"AAAA", "2001:db8::1", "2001:DB8::1", true},
+		{"AAAA", "2001:db8::1", "2001:db8:0:0::1", true},
+		{"AAAA", "2001:db8::1", "2001:db8::2", false},
+	}
+	for _, test := range tests {
+		if matches := contentMatches(test.record_type, test.live, test.desired); matches != test.matches {
+			t.Errorf("contentMatches(%s, '%s', '%s') = %t, want %t", test.record_type, test.live, test.desired, matches, test.matches)
+		}
+	}
+}
+
+func TestUpdateOnceIPv6Spelling(t *testing.T) {
+	api, server := newFakeAPI(t, cloudflare.DNSRecord{ID: "aaaa", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1", TTL: 1})
+	u := newTestUpdater(t, server, Config{RecordName: "home"}, "2001:DB8::1")
+
+	result, err := u.UpdateOnce(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateOnce() failed: %s", err.Error())
+	}
+	if patches := api.Patches(); len(patches) > 0 {
+		t.Errorf("records %v were updated, 2001:DB8::1 is the content they already have", patches)
+	}
+	if got := actions(result.Checks[0]); len(got) != 1 || got[0] != "home.example.com:unchanged" {
+		t.Errorf("actions are %v, want [home.example.com:unchanged]", got)
+	}
+}
+
+// homeRecords returns an A record of home.example.com per content, with the
+// ids a1, a2, ...
+func homeRecords(contents ...string) []cloudflare.DNSRecord {
+	records := []cloudflare.DNSRecord{}
+	for i, content := range contents {
+		records = append(records, cloudflare.DNSRecord{ID: fmt.Sprintf("a%d", i+1), Type: "A", Name: "home.example.com", Content: content, TTL: 1})
+	}
+	return records
+}
+
+func TestMultiRecordStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		patches  []string
+		actions  []string
+		fails    bool
+	}{
+		{"", []string{"a3"}, []string{"updated"}, false},
+		{"last", []string{"a3"}, []string{"updated"}, false},
+		{"first", []string{"a1"}, []string{"updated"}, false},
+		{"all", []string{"a1", "a2", "a3"}, []string{"updated", "updated", "updated"}, false},
+		{"skip", []string{}, []string{"skipped", "skipped", "skipped"}, false},
+		{"error", []string{}, []string{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.strategy, func(t *testing.T) {
+			api, server := newFakeAPI(t, homeRecords("198.51.100.1", "198.51.100.1", "198.51.100.1")...)
+			u := newTestUpdater(t, server, Config{RecordName: "home", MultiRecordStrategy: test.strategy}, "198.51.100.7")
+
+			result, err := u.UpdateOnce(context.Background())
+			if (err != nil) != test.fails {
+				t.Fatalf("UpdateOnce() returned %v, want an error: %t", err, test.fails)
+			}
+			if patches := api.Patches(); strings.Join(patches, ",") != strings.Join(test.patches, ",") {
+				t.Errorf("updated %v, want %v", patches, test.patches)
+			}
+			got := []string{}
+			for _, record := range result.Checks[0].Records {
+				got = append(got, record.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(test.actions, ",") {
+				t.Errorf("actions are %v, want %v", got, test.actions)
+			}
+		})
+	}
+}
+
+func TestUpdateOnceUnchanged(t *testing.T) {
+	api, server := newFakeAPI(t, cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.7", TTL: 1})
+	logger := &testLogger{}
+	u := newTestUpdater(t, server, Config{RecordName: "home", Logger: logger}, "198.51.100.7")
+
+	result, err := u.UpdateOnce(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateOnce() failed: %s", err.Error())
+	}
+	if patches := api.Patches(); len(patches) > 0 {
+		t.Errorf("records %v were updated, their content already matched", patches)
+	}
+	if got := actions(result.Checks[0]); len(got) != 1 || got[0] != "home.example.com:unchanged" {
+		t.Errorf("actions are %v, want [home.example.com:unchanged]", got)
+	}
+	if !logger.Logged("record is already up-to-date") {
+		t.Errorf("the up-to-date record was not logged")
+	}
+}
+
+func TestUpdateOnceLogsChangeFields(t *testing.T) {
+	_, server := newFakeAPI(t, homeRecords("198.51.100.7")...)
+	logger := &fieldTestLogger{}
+	u := newTestUpdater(t, server, Config{RecordName: "home", Logger: logger}, "203.0.113.9")
+
+	if _, err := u.UpdateOnce(context.Background()); err != nil {
+		t.Fatalf("UpdateOnce() failed: %s", err.Error())
+	}
+	if !logger.Logged("record 'home.example.com' has been successfully updated: content 198.51.100.7 -> 203.0.113.9") {
+		t.Errorf("the update was not logged, got %v", logger.lines)
+	}
+	if len(logger.fields) != 1 {
+		t.Fatalf("%d lines were logged with fields, want 1", len(logger.fields))
+	}
+	fields := logger.fields[0]
+	if fields["record"] != "home.example.com" {
+		t.Errorf("record is %v, want home.example.com", fields["record"])
+	}
+	if old, ok := fields["old"].(map[string]any); !ok || old["content"] != "198.51.100.7" {
+		t.Errorf("old is %v, want content 198.51.100.7", fields["old"])
+	}
+	if updated, ok := fields["new"].(map[string]any); !ok || updated["content"] != "203.0.113.9" {
+		t.Errorf("new is %v, want content 203.0.113.9", fields["new"])
+	}
+	if changed, ok := fields["changed"].([]string); !ok || strings.Join(changed, ",") != "content" {
+		t.Errorf("changed is %v, want [content]", fields["changed"])
+	}
+}
+
+func TestApplyIPFamilyGuard(t *testing.T) {
+	tests := []struct {
+		record_type string
+		ip          string
+		allow       bool
+		mismatches  bool
+	}{
+		{"A", "2001:db8::1", false, true},
+		{"AAAA", "198.51.100.7", false, true},
+		{"AAAA", "198.51.100.7", true, false},
+		{"A", "198.51.100.7", false, false},
+		{"AAAA", "2001:db8::1", false, false},
+	}
+	for _, test := range tests {
+		api, server := newFakeAPI(t,
+			cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 1},
+			cloudflare.DNSRecord{ID: "aaaa", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2", TTL: 1},
+		)
+		u := newTestUpdater(t, server, Config{RecordName: "home", AllowMappedIPv6: test.allow}, "")
+
+		check := Check{RecordType: test.record_type}
+		err := u.applyIP(context.Background(), "", net.ParseIP(test.ip), 0, &check)
+		if errors.Is(err, ErrFamilyMismatch) != test.mismatches {
+			t.Errorf("applyIP(%s into %s) returned %v, want a family mismatch: %t", test.ip, test.record_type, err, test.mismatches)
+		}
+		if patches := api.Patches(); test.mismatches && len(patches) > 0 {
+			t.Errorf("applyIP(%s into %s) updated %v", test.ip, test.record_type, patches)
+		}
+	}
+}
+
+func TestUpdateOnceSingleStack(t *testing.T) {
+	tests := []struct {
+		skip  bool
+		fails bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for _, test := range tests {
+		api, server := newFakeAPI(t, cloudflare.DNSRecord{ID: "a", Type: "A", Name: "home.example.com", Content: "198.51.100.1", TTL: 1})
+		// only an IPv6 address is detectable for the A record
+		u := newTestUpdater(t, server, Config{RecordName: "home", Families: []string{"4"}, SkipFamilyMismatch: test.skip}, "2001:db8::1")
+
+		result, err := u.UpdateOnce(context.Background())
+		if (err != nil) != test.fails {
+			t.Errorf("UpdateOnce() with skipping %t returned %v, want an error: %t", test.skip, err, test.fails)
+		}
+		if test.fails && !errors.Is(err, ErrFamilyMismatch) {
+			t.Errorf("UpdateOnce() returned %v, want a family mismatch", err)
+		}
+		if len(result.Checks[0].Records) > 0 || len(api.Patches()) > 0 {
+			t.Errorf("UpdateOnce() with skipping %t touched the records %v", test.skip, actions(result.Checks[0]))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UpdateWindow is a daily time range, optionally restricted to some weekdays,
+// during which records may be written.
+type UpdateWindow struct {
+	text  string
+	start int
+	end   int
+	days  [7]bool
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseWeekday(name string) (int, error) {
+	for i, weekday := range weekdays {
+		if strings.EqualFold(name, weekday) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not a weekday, use mon, tue, wed, thu, fri, sat or sun", name)
+}
+
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time of the form HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// ParseUpdateWindow parses "HH:MM-HH:MM" in local time, optionally followed by
+// weekdays as a range or list, e.g. "02:00-04:00 mon-fri" or "22:00-02:00 sat,sun".
+// A window crossing midnight belongs to the weekday it starts on.
+func ParseUpdateWindow(window_string string) (*UpdateWindow, error) {
+	fields := strings.Fields(window_string)
+	if len(fields) < 1 || len(fields) > 2 {
+		return nil, fmt.Errorf("update window '%s' is not of the form 'HH:MM-HH:MM [days]'", window_string)
+	}
+
+	window := &UpdateWindow{text: window_string}
+	start, end, valid := strings.Cut(fields[0], "-")
+	if !valid {
+		return nil, fmt.Errorf("update window '%s' is not of the form 'HH:MM-HH:MM [days]'", window_string)
+	}
+	var err error
+	if window.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if window.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("update window '%s' is empty", window_string)
+	}
+
+	if len(fields) < 2 {
+		for i := range window.days {
+			window.days[i] = true
+		}
+		return window, nil
+	}
+	for _, days := range strings.Split(fields[1], ",") {
+		first, last, is_range := strings.Cut(days, "-")
+		from, err := parseWeekday(first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if is_range {
+			if to, err = parseWeekday(last); err != nil {
+				return nil, err
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return window, nil
+}
+
+func (w *UpdateWindow) String() string {
+	return w.text
+}
+
+// Contains reports whether records may be written at the given time.
+func (w *UpdateWindow) Contains(t time.Time) bool {
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+	today, yesterday := int(t.Weekday()), (int(t.Weekday())+6)%7
+	if w.start < w.end {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	return w.days[today] && minute >= w.start || w.days[yesterday] && minute < w.end
+}
+
+// inUpdateWindow reports whether the record name may be written now, every
+// create and update goes through it. Outside of the window it logs that the
+// write is skipped.
+func (u *Updater) inUpdateWindow(name string) bool {
+	if u.config.UpdateWindow == nil || u.config.UpdateWindow.Contains(u.clock.Now()) {
+		return true
+	}
+	u.logger.Infof("not writing '%s', it is outside of the update window '%s'\n", name, u.config.UpdateWindow.String())
+	return false
+}